@@ -83,6 +83,22 @@ type OAuthClientCredentials struct {
 type CDNConfig struct {
 	Enabled     bool            `json:"enabled"`
 	CachePolicy *CacheKeyPolicy `json:"cachePolicy,omitempty"`
+	// BypassCacheOnRequestHeaders lists request headers whose presence causes
+	// the response to bypass the CDN cache.
+	BypassCacheOnRequestHeaders []*BypassCacheOnRequestHeader `json:"bypassCacheOnRequestHeaders,omitempty"`
+	// ServeWhileStale is the number of seconds the response may be served
+	// stale while the cached entry is revalidated.
+	ServeWhileStale int64 `json:"serveWhileStale,omitempty"`
+}
+
+// BypassCacheOnRequestHeader contains configuration for how requests
+// containing specific request headers bypass the cache, even if the content
+// was previously cached.
+// +k8s:openapi-gen=true
+type BypassCacheOnRequestHeader struct {
+	// The header field name to match on when bypassing cache. Values are
+	// case-insensitive.
+	HeaderName string `json:"headerName,omitempty"`
 }
 
 // CacheKeyPolicy contains configuration for how requests to a CDN-enabled backend are cached.
@@ -1,3 +1,4 @@
+//go:build !ignore_autogenerated
 // +build !ignore_autogenerated
 
 /*
@@ -157,6 +158,22 @@ func (in *BackendConfigStatus) DeepCopy() *BackendConfigStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BypassCacheOnRequestHeader) DeepCopyInto(out *BypassCacheOnRequestHeader) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BypassCacheOnRequestHeader.
+func (in *BypassCacheOnRequestHeader) DeepCopy() *BypassCacheOnRequestHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(BypassCacheOnRequestHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CDNConfig) DeepCopyInto(out *CDNConfig) {
 	*out = *in
@@ -165,6 +182,17 @@ func (in *CDNConfig) DeepCopyInto(out *CDNConfig) {
 		*out = new(CacheKeyPolicy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.BypassCacheOnRequestHeaders != nil {
+		in, out := &in.BypassCacheOnRequestHeaders, &out.BypassCacheOnRequestHeaders
+		*out = make([]*BypassCacheOnRequestHeader, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(BypassCacheOnRequestHeader)
+				**out = **in
+			}
+		}
+	}
 	return
 }
 
@@ -1,3 +1,4 @@
+//go:build !ignore_autogenerated
 // +build !ignore_autogenerated
 
 /*
@@ -93,6 +94,11 @@ func (in *FrontendConfigSpec) DeepCopyInto(out *FrontendConfigSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.RedirectToHttps != nil {
+		in, out := &in.RedirectToHttps, &out.RedirectToHttps
+		*out = new(HttpsRedirectConfig)
+		**out = **in
+	}
 	return
 }
 
@@ -106,6 +112,22 @@ func (in *FrontendConfigSpec) DeepCopy() *FrontendConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HttpsRedirectConfig) DeepCopyInto(out *HttpsRedirectConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HttpsRedirectConfig.
+func (in *HttpsRedirectConfig) DeepCopy() *HttpsRedirectConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(HttpsRedirectConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FrontendConfigStatus) DeepCopyInto(out *FrontendConfigStatus) {
 	*out = *in
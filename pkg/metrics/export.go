@@ -0,0 +1,321 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// snapshotVersion is the schema version of the snapshots produced by
+	// ExportJSON. Bump this whenever the Snapshot schema changes in an
+	// incompatible way.
+	snapshotVersion = "v1"
+	// unknownFeatureBucket collects counts for feature names that are not
+	// known to this version of the controller when importing a snapshot.
+	unknownFeatureBucket = "unknown"
+)
+
+// Snapshot is a point-in-time copy of all computed feature counts.
+type Snapshot struct {
+	// Version is the snapshot schema version.
+	Version string `json:"version"`
+	// Timestamp records when the snapshot was computed.
+	Timestamp time.Time `json:"timestamp"`
+	// IngressCounts is the count of ingresses for each feature.
+	IngressCounts map[string]int `json:"ingressCounts"`
+	// ServicePortCounts is the count of service ports for each feature.
+	ServicePortCounts map[string]int `json:"servicePortCounts"`
+	// NegCounts is the count of NEGs for each feature.
+	NegCounts map[string]int `json:"negCounts"`
+}
+
+// Snapshot computes all feature counts and returns them as a Snapshot.
+func (im *ControllerMetrics) Snapshot() Snapshot {
+	ingCount, svcPortCount := im.computeIngressMetrics()
+	negCount := im.computeNegMetrics()
+	return Snapshot{
+		Version:           snapshotVersion,
+		Timestamp:         im.clock.Now(),
+		IngressCounts:     im.aliasedCounts(ingCount),
+		ServicePortCounts: im.aliasedCounts(svcPortCount),
+		NegCounts:         im.aliasedCounts(negCount),
+	}
+}
+
+// DeltaSinceLastSnapshot computes all feature counts across the ingress,
+// service port and NEG families and returns the signed difference against the
+// counts remembered from the previous call, updating the remembered baseline.
+// The first call reports the current counts against an all-zero baseline.
+func (im *ControllerMetrics) DeltaSinceLastSnapshot() map[feature]int {
+	ingCount, svcPortCount := im.computeIngressMetrics()
+	negCount := im.computeNegMetrics()
+	current := make(map[feature]int)
+	for _, counts := range []map[feature]int{ingCount, svcPortCount, negCount} {
+		for ftr, count := range counts {
+			current[ftr] += count
+		}
+	}
+	im.Lock()
+	defer im.Unlock()
+	delta := make(map[feature]int, len(current))
+	for ftr, count := range current {
+		delta[ftr] = count - im.lastSnapshotCounts[ftr]
+	}
+	for ftr, count := range im.lastSnapshotCounts {
+		if _, ok := current[ftr]; !ok {
+			delta[ftr] = -count
+		}
+	}
+	im.lastSnapshotCounts = current
+	return delta
+}
+
+// StartExportLoop computes a snapshot of all feature counts on the given
+// interval and feeds it to exporter. It returns immediately; the loop stops
+// and its goroutine exits once ctx is cancelled.
+func (im *ControllerMetrics) StartExportLoop(ctx context.Context, interval time.Duration, exporter func(Snapshot)) {
+	klog.V(3).Infof("Starting metrics export loop with an interval of %v", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				klog.V(3).Infof("Stopping metrics export loop: %v", ctx.Err())
+				return
+			case <-ticker.C:
+				if ctx.Err() != nil {
+					return
+				}
+				exporter(im.Snapshot())
+			}
+		}
+	}()
+}
+
+// ExportJSON serializes a snapshot of all computed feature counts to JSON.
+func (im *ControllerMetrics) ExportJSON() ([]byte, error) {
+	return json.Marshal(im.Snapshot())
+}
+
+// ImportJSON parses data in the format produced by ExportJSON. It rejects
+// snapshots with a mismatched schema version. Counts for feature names that
+// are not known to this controller version are collected into the "unknown"
+// bucket of the respective feature family rather than failing the import.
+func ImportJSON(data []byte) (Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to parse snapshot: %v", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %q, want %q", snapshot.Version, snapshotVersion)
+	}
+	ingFeatures, svcPortFeatures := initializeCounts()
+	snapshot.IngressCounts = bucketUnknownFeatures(snapshot.IngressCounts, ingFeatures)
+	snapshot.ServicePortCounts = bucketUnknownFeatures(snapshot.ServicePortCounts, svcPortFeatures)
+	snapshot.NegCounts = bucketUnknownFeatures(snapshot.NegCounts, negFeatureCounts())
+	return snapshot, nil
+}
+
+// MergeSnapshots merges snapshots taken by multiple controller shards into a
+// single cluster-wide snapshot by summing the counts of each feature family.
+// The merged snapshot carries the newest timestamp of the inputs.
+func MergeSnapshots(snaps ...Snapshot) Snapshot {
+	merged := Snapshot{
+		Version:           snapshotVersion,
+		IngressCounts:     make(map[string]int),
+		ServicePortCounts: make(map[string]int),
+		NegCounts:         make(map[string]int),
+	}
+	for _, snap := range snaps {
+		if snap.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = snap.Timestamp
+		}
+		mergeCounts(merged.IngressCounts, snap.IngressCounts)
+		mergeCounts(merged.ServicePortCounts, snap.ServicePortCounts)
+		mergeCounts(merged.NegCounts, snap.NegCounts)
+	}
+	return merged
+}
+
+// mergeCounts adds the given counts into the accumulated counts.
+func mergeCounts(merged, counts map[string]int) {
+	for name, count := range counts {
+		merged[name] += count
+	}
+}
+
+// metricsFamilies returns the feature count map and the prometheus metric
+// name for each feature family.
+func (im *ControllerMetrics) metricsFamilies() []metricsFamily {
+	ingCount, svcPortCount := im.computeIngressMetrics()
+	return []metricsFamily{
+		{name: "ingress", metricName: "number_of_ingresses", counts: ingCount},
+		{name: "servicePort", metricName: "number_of_service_ports", counts: svcPortCount},
+		{name: "neg", metricName: "number_of_negs", counts: im.computeNegMetrics()},
+	}
+}
+
+// metricsFamily groups the computed counts of one feature family.
+type metricsFamily struct {
+	name       string
+	metricName string
+	counts     map[feature]int
+}
+
+// StreamMetrics computes all feature counts and writes them to w one feature
+// at a time, without materializing the combined metrics structure. Supported
+// formats are "json" (one JSON object per line) and "prometheus" (prometheus
+// text exposition format). Output is sorted by family and feature name.
+func (im *ControllerMetrics) StreamMetrics(w io.Writer, format string) error {
+	if format != "json" && format != "prometheus" {
+		return fmt.Errorf("unsupported stream format %q, want %q or %q", format, "json", "prometheus")
+	}
+	for _, family := range im.metricsFamilies() {
+		features := sortedFeatures(family.counts)
+		for _, ftr := range features {
+			var err error
+			switch format {
+			case "json":
+				err = json.NewEncoder(w).Encode(streamedCount{Family: family.name, Feature: ftr.String(), Count: family.counts[ftr]})
+			case "prometheus":
+				_, err = fmt.Fprintf(w, "%s{%s=%q} %d\n", family.metricName, label, ftr.String(), family.counts[ftr])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to stream %s metrics: %v", family.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteGraphite computes all feature counts and writes them to w in the
+// Graphite plaintext protocol, one "<prefix>.<family>_feature.<feature> <value>
+// <timestamp>" line per feature. Metric path segments are sanitized into
+// lowercase snake case. Output is sorted by family and feature name.
+func (im *ControllerMetrics) WriteGraphite(w io.Writer, prefix string, ts time.Time) error {
+	for _, family := range im.metricsFamilies() {
+		for _, ftr := range sortedFeatures(family.counts) {
+			path := fmt.Sprintf("%s.%s_feature.%s", prefix, graphiteSegment(family.name), graphiteSegment(ftr.String()))
+			if _, err := fmt.Fprintf(w, "%s %d %d\n", path, family.counts[ftr], ts.Unix()); err != nil {
+				return fmt.Errorf("failed to write %s metrics: %v", family.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExportCSV computes all feature counts and writes them to w as CSV with a
+// "family,feature,count" header row and one row per feature across the
+// ingress, service port and NEG families. Output is sorted by family and
+// feature name.
+func (im *ControllerMetrics) ExportCSV(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write([]string{"family", "feature", "count"}); err != nil {
+		return fmt.Errorf("failed to write CSV header: %v", err)
+	}
+	for _, family := range im.metricsFamilies() {
+		for _, ftr := range sortedFeatures(family.counts) {
+			if err := csvWriter.Write([]string{family.name, ftr.String(), strconv.Itoa(family.counts[ftr])}); err != nil {
+				return fmt.Errorf("failed to write %s metrics: %v", family.name, err)
+			}
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// graphiteSegment sanitizes given name into a Graphite-safe metric path
+// segment by converting camel case to lowercase snake case and replacing any
+// remaining non-alphanumeric characters with underscores.
+func graphiteSegment(name string) string {
+	var segment []rune
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			// Split camel case words, keeping acronyms like CDN together.
+			if i > 0 && (isLowerAlnum(rune(name[i-1])) || (i+1 < len(name) && isLowerAlnum(rune(name[i+1])))) {
+				segment = append(segment, '_')
+			}
+			segment = append(segment, r+'a'-'A')
+		case isLowerAlnum(r):
+			segment = append(segment, r)
+		default:
+			segment = append(segment, '_')
+		}
+	}
+	return string(segment)
+}
+
+// isLowerAlnum returns true if given rune is a lowercase letter or a digit.
+func isLowerAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+// streamedCount is the JSON line format emitted by StreamMetrics.
+type streamedCount struct {
+	Family  string `json:"family"`
+	Feature string `json:"feature"`
+	Count   int    `json:"count"`
+}
+
+// sortedFeatures returns the keys of given feature count map sorted by name.
+func sortedFeatures(counts map[feature]int) []feature {
+	features := make([]feature, 0, len(counts))
+	for ftr := range counts {
+		features = append(features, ftr)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+	return features
+}
+
+// featureCountsToStrings converts a feature count map into the serializable
+// string-keyed form used by Snapshot.
+func featureCountsToStrings(counts map[feature]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for ftr, count := range counts {
+		out[ftr.String()] = count
+	}
+	return out
+}
+
+// bucketUnknownFeatures folds counts keyed by feature names missing from the
+// given known feature set into the "unknown" bucket.
+func bucketUnknownFeatures(counts map[string]int, known map[feature]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	out := make(map[string]int, len(counts))
+	for name, count := range counts {
+		if _, ok := known[feature(name)]; !ok {
+			out[unknownFeatureBucket] += count
+			continue
+		}
+		out[name] = count
+	}
+	return out
+}
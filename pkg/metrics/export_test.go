@@ -0,0 +1,337 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newTestControllerMetrics returns a ControllerMetrics populated with all
+// ingress state and neg state fixtures.
+func newTestControllerMetrics() *ControllerMetrics {
+	newMetrics := NewControllerMetrics()
+	for _, ingState := range ingressStates {
+		ingKey := fmt.Sprintf("%s/%s", defaultNamespace, ingState.ing.Name)
+		newMetrics.SetIngress(ingKey, NewIngressState(ingState.ing, ingState.svcPorts))
+	}
+	newMetrics.SetNegService("default/neg-service1", newNegState(0, 1, 0))
+	newMetrics.SetNegService("default/neg-service2", newNegState(2, 0, 1))
+	return newMetrics
+}
+
+func TestHealthSummary(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	// The fixtures carry 12 ingresses, 4 unique service ports, 4 NEGs and 3
+	// ingresses flagged with iapWithoutTLS.
+	expectSummary := HealthSummary{
+		Ingresses:    12,
+		ServicePorts: 4,
+		Negs:         4,
+		RiskFlags:    3,
+	}
+	if diff := cmp.Diff(expectSummary, newMetrics.HealthSummary()); diff != "" {
+		t.Errorf("Got diff for health summary (-want +got):\n%s", diff)
+	}
+}
+
+func TestTopFeatures(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	expectTop := []FeatureCount{
+		{Feature: ingress.String(), Count: 12},
+		{Feature: externalIngress.String(), Count: 11},
+		{Feature: httpEnabled.String(), Count: 11},
+	}
+	if diff := cmp.Diff(expectTop, newMetrics.TopFeatures(3)); diff != "" {
+		t.Errorf("Got diff for top features (-want +got):\n%s", diff)
+	}
+}
+
+func TestStreamMetrics(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	var buf bytes.Buffer
+	if err := newMetrics.StreamMetrics(&buf, "json"); err != nil {
+		t.Fatalf("StreamMetrics(json) = %v, want nil", err)
+	}
+	gotIngressCounts := make(map[feature]int)
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var line streamedCount
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatalf("Failed to decode streamed line: %v", err)
+		}
+		if line.Family == "ingress" {
+			gotIngressCounts[feature(line.Feature)] = line.Count
+		}
+	}
+	expectIngressCounts, _ := newMetrics.computeIngressMetrics()
+	if diff := cmp.Diff(expectIngressCounts, gotIngressCounts); diff != "" {
+		t.Errorf("Got diff between streamed and computed ingress counts (-want +got):\n%s", diff)
+	}
+
+	var promBuf bytes.Buffer
+	if err := newMetrics.StreamMetrics(&promBuf, "prometheus"); err != nil {
+		t.Fatalf("StreamMetrics(prometheus) = %v, want nil", err)
+	}
+	if !strings.Contains(promBuf.String(), fmt.Sprintf("number_of_ingresses{feature=%q} %d", ingress, expectIngressCounts[ingress])) {
+		t.Errorf("Streamed prometheus output is missing the %s count:\n%s", ingress, promBuf.String())
+	}
+
+	if err := newMetrics.StreamMetrics(&buf, "xml"); err == nil {
+		t.Error("StreamMetrics(xml) = nil, want unsupported format error")
+	}
+}
+
+func TestWriteGraphite(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	ts := time.Unix(1500000000, 0)
+	var buf bytes.Buffer
+	if err := newMetrics.WriteGraphite(&buf, "gke.ingress", ts); err != nil {
+		t.Fatalf("WriteGraphite() = %v, want nil", err)
+	}
+	expectIngressCounts, _ := newMetrics.computeIngressMetrics()
+	expectLine := fmt.Sprintf("gke.ingress.ingress_feature.cloud_cdn %d %d", expectIngressCounts[cloudCDN], ts.Unix())
+	if !strings.Contains(buf.String(), expectLine+"\n") {
+		t.Errorf("Graphite output is missing line %q:\n%s", expectLine, buf.String())
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if fields := strings.Fields(line); len(fields) != 3 {
+			t.Errorf("Got %d fields in graphite line %q, want 3", len(fields), line)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	var buf bytes.Buffer
+	if err := newMetrics.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV() = %v, want nil", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse exported CSV: %v", err)
+	}
+	if diff := cmp.Diff([]string{"family", "feature", "count"}, records[0]); diff != "" {
+		t.Errorf("Got diff for CSV header (-want +got):\n%s", diff)
+	}
+	expectIngressCounts, expectSvcPortCounts := newMetrics.computeIngressMetrics()
+	expectRows := 1 + len(expectIngressCounts) + len(expectSvcPortCounts) + len(newMetrics.computeNegMetrics())
+	if len(records) != expectRows {
+		t.Errorf("Got %d CSV rows, want %d", len(records), expectRows)
+	}
+	expectRecord := []string{"ingress", ingress.String(), strconv.Itoa(expectIngressCounts[ingress])}
+	found := false
+	for _, record := range records[1:] {
+		if cmp.Diff(expectRecord, record) == "" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("Exported CSV is missing record %v:\n%s", expectRecord, buf.String())
+	}
+}
+
+func TestGraphiteSegment(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"CloudCDN", "cloud_cdn"},
+		{"HTTPEnabled", "http_enabled"},
+		{"NEGDefaultHealthCheck", "neg_default_health_check"},
+		{"servicePort", "service_port"},
+		{"with-dash.dot", "with_dash_dot"},
+	} {
+		if got := graphiteSegment(tc.name); got != tc.want {
+			t.Errorf("graphiteSegment(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFeatureAliases(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	newMetrics.RegisterFeatureAlias("TotalIngresses", ingress)
+	data, err := newMetrics.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON() = %v, want nil", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("Failed to parse exported snapshot: %v", err)
+	}
+	gotCount, ok := snapshot.IngressCounts[ingress.String()]
+	if !ok {
+		t.Fatalf("Exported snapshot is missing the %s count", ingress)
+	}
+	gotAliasCount, ok := snapshot.IngressCounts["TotalIngresses"]
+	if !ok {
+		t.Fatalf("Exported snapshot is missing the %q alias count", "TotalIngresses")
+	}
+	if gotAliasCount != gotCount {
+		t.Errorf("Got %d ingresses under the alias name, want %d", gotAliasCount, gotCount)
+	}
+}
+
+func TestStartExportLoop(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshots := make(chan Snapshot, 100)
+	newMetrics.StartExportLoop(ctx, time.Millisecond, func(snapshot Snapshot) {
+		snapshots <- snapshot
+	})
+	select {
+	case snapshot := <-snapshots:
+		if gotCount := snapshot.IngressCounts[ingress.String()]; gotCount != len(ingressStates) {
+			t.Errorf("Got %d ingresses in the exported snapshot, want %d", gotCount, len(ingressStates))
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Timed out waiting for the export loop to produce a snapshot")
+	}
+	cancel()
+	// Drain any export that was in flight when the loop observed the cancel,
+	// then verify that no further snapshots arrive.
+	time.Sleep(50 * time.Millisecond)
+	for len(snapshots) > 0 {
+		<-snapshots
+	}
+	time.Sleep(50 * time.Millisecond)
+	if gotCount := len(snapshots); gotCount != 0 {
+		t.Errorf("Got %d snapshots after cancelling the export loop, want 0", gotCount)
+	}
+}
+
+func TestMergeSnapshots(t *testing.T) {
+	t.Parallel()
+	shard1 := Snapshot{
+		Version:           snapshotVersion,
+		Timestamp:         time.Unix(1000, 0),
+		IngressCounts:     map[string]int{ingress.String(): 3, cloudCDN.String(): 1},
+		ServicePortCounts: map[string]int{servicePort.String(): 2},
+		NegCounts:         map[string]int{neg.String(): 4},
+	}
+	shard2 := Snapshot{
+		Version:           snapshotVersion,
+		Timestamp:         time.Unix(2000, 0),
+		IngressCounts:     map[string]int{ingress.String(): 2, staticGlobalIP.String(): 1},
+		ServicePortCounts: map[string]int{servicePort.String(): 1},
+	}
+	expectMerged := Snapshot{
+		Version:           snapshotVersion,
+		Timestamp:         time.Unix(2000, 0),
+		IngressCounts:     map[string]int{ingress.String(): 5, cloudCDN.String(): 1, staticGlobalIP.String(): 1},
+		ServicePortCounts: map[string]int{servicePort.String(): 3},
+		NegCounts:         map[string]int{neg.String(): 4},
+	}
+	if diff := cmp.Diff(expectMerged, MergeSnapshots(shard1, shard2)); diff != "" {
+		t.Errorf("Got diff for merged snapshot (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	want := newMetrics.Snapshot()
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal(%+v) = %v, want nil", want, err)
+	}
+	got, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON() = %v, want nil", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Got diff for imported snapshot (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportJSONUnknownFeature(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	snapshot := newMetrics.Snapshot()
+	snapshot.IngressCounts["ForgedFeature"] = 3
+	snapshot.IngressCounts["AnotherForgedFeature"] = 2
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("json.Marshal(%+v) = %v, want nil", snapshot, err)
+	}
+	got, err := ImportJSON(data)
+	if err != nil {
+		t.Fatalf("ImportJSON() = %v, want nil", err)
+	}
+	if _, ok := got.IngressCounts["ForgedFeature"]; ok {
+		t.Errorf("Imported snapshot retained unknown feature %q", "ForgedFeature")
+	}
+	if gotCount := got.IngressCounts[unknownFeatureBucket]; gotCount != 5 {
+		t.Errorf("Got %d ingresses in the %q bucket, want 5", gotCount, unknownFeatureBucket)
+	}
+}
+
+func TestImportJSONVersionMismatch(t *testing.T) {
+	t.Parallel()
+	newMetrics := newTestControllerMetrics()
+	snapshot := newMetrics.Snapshot()
+	snapshot.Version = "v0"
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("json.Marshal(%+v) = %v, want nil", snapshot, err)
+	}
+	if _, err := ImportJSON(data); err == nil {
+		t.Error("ImportJSON() = nil, want version mismatch error")
+	}
+}
+
+func TestDeltaSinceLastSnapshot(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	if delta := newMetrics.DeltaSinceLastSnapshot(); delta[ingress] != 0 {
+		t.Errorf("Got initial delta %d for feature %s, want 0", delta[ingress], ingress)
+	}
+	ingKey := fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[3].ing.Name)
+	newMetrics.SetIngress(ingKey, NewIngressState(ingressStates[3].ing, ingressStates[3].svcPorts))
+	delta := newMetrics.DeltaSinceLastSnapshot()
+	for _, ftr := range []feature{ingress, externalIngress, httpEnabled, hostBasedRouting} {
+		if delta[ftr] != 1 {
+			t.Errorf("Got delta %d for feature %s, want 1", delta[ftr], ftr)
+		}
+	}
+	if delta[tlsTermination] != 0 {
+		t.Errorf("Got delta %d for feature %s, want 0", delta[tlsTermination], tlsTermination)
+	}
+	newMetrics.DeleteIngress(ingKey)
+	if delta := newMetrics.DeltaSinceLastSnapshot(); delta[ingress] != -1 {
+		t.Errorf("Got delta %d for feature %s after deletion, want -1", delta[ingress], ingress)
+	}
+}
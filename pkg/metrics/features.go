@@ -18,9 +18,14 @@ package metrics
 
 import (
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
@@ -44,40 +49,248 @@ const (
 	// certificate for the Ingress controller to use.
 	preSharedCertKey = "ingress.gcp.kubernetes.io/pre-shared-cert"
 	managedCertKey   = "networking.gke.io/managed-certificates"
+	// regionalManagedCertKey represents the regional managed certificates
+	// for the Ingress controller to use.
+	regionalManagedCertKey = "networking.gke.io/regional-managed-certificates"
 	// staticIPKey is the annotation key used by controller to record GCP static ip.
 	staticIPKey = "ingress.kubernetes.io/static-ip"
+	// trafficSplitKey is the annotation key used to configure traffic-split
+	// weights for the backends of an ingress.
+	trafficSplitKey = "networking.gke.io/traffic-split-weights"
+	// frontendConfigKey is the annotation key that ties an ingress to a
+	// FrontendConfig resource.
+	frontendConfigKey = "networking.gke.io/v1beta1.FrontendConfig"
+	// customDefaultBackendKey is the annotation key used to configure a
+	// custom backend for requests that match no ingress rule.
+	customDefaultBackendKey = "networking.gke.io/custom-default-backend"
+	// maxRatePerEndpointKey and maxConnectionsKey are the annotation keys
+	// used to override the balancing capacity of a backend.
+	maxRatePerEndpointKey = "networking.gke.io/max-rate-per-endpoint"
+	maxConnectionsKey     = "networking.gke.io/max-connections"
+	// ingressTimeoutKey is the annotation key used to configure a request
+	// timeout for the whole ingress rather than a single backend.
+	ingressTimeoutKey = "networking.gke.io/request-timeout"
+	// globalAccessKey is the annotation key used to allow clients from all
+	// regions to reach an internal load balancer.
+	globalAccessKey = "networking.gke.io/internal-load-balancer-allow-global-access"
+	// certMapKey is the annotation key used to attach an externally managed
+	// certificate map instead of the built-in cert sources.
+	certMapKey = "networking.gke.io/certmap"
 
-	ingress                = feature("Ingress")
-	externalIngress        = feature("ExternalIngress")
-	internalIngress        = feature("InternalIngress")
-	httpEnabled            = feature("HTTPEnabled")
-	hostBasedRouting       = feature("HostBasedRouting")
-	pathBasedRouting       = feature("PathBasedRouting")
+	ingress         = feature("Ingress")
+	externalIngress = feature("ExternalIngress")
+	internalIngress = feature("InternalIngress")
+	// ilbGlobalAccess is reported for an internal ingress that is annotated
+	// to accept clients from all regions.
+	ilbGlobalAccess = feature("ILBGlobalAccess")
+	// conflictingIngressClass is reported for an external ingress that also
+	// carries internal-only annotations.
+	conflictingIngressClass = feature("ConflictingIngressClass")
+	// alphaIngressClass is reported for an ingress that uses the preview
+	// ingress class, to monitor alpha adoption.
+	alphaIngressClass = feature("AlphaIngressClass")
+	httpEnabled       = feature("HTTPEnabled")
+	hostBasedRouting  = feature("HostBasedRouting")
+	// hostNameTooLong is reported for an ingress with a rule host that
+	// exceeds the host name length limit and hence would be rejected by the
+	// GCE URL map.
+	hostNameTooLong  = feature("HostNameTooLong")
+	pathBasedRouting = feature("PathBasedRouting")
+	// hostlessPathRules is reported for an ingress with a rule that carries
+	// http paths but no host, which matches requests for any host.
+	hostlessPathRules = feature("HostlessPathRules")
+	// namedServicePort and numberedServicePort are reported for an ingress
+	// whose backends reference a service port by name and by number
+	// respectively.
+	namedServicePort       = feature("NamedServicePort")
+	numberedServicePort    = feature("NumberedServicePort")
 	tlsTermination         = feature("TLSTermination")
 	secretBasedCertsForTLS = feature("SecretBasedCertsForTLS")
-	preSharedCertsForTLS   = feature("PreSharedCertsForTLS")
-	managedCertsForTLS     = feature("ManagedCertsForTLS")
-	staticGlobalIP         = feature("StaticGlobalIP")
+	// crossNamespaceSecret is reported for an ingress whose TLS secret name
+	// carries a namespace qualifier pointing outside the ingress namespace,
+	// which is disallowed.
+	crossNamespaceSecret = feature("CrossNamespaceSecret")
+	preSharedCertsForTLS = feature("PreSharedCertsForTLS")
+	// duplicatePreSharedCerts is reported for an ingress whose pre-shared
+	// cert annotation lists the same certificate name more than once.
+	duplicatePreSharedCerts = feature("DuplicatePreSharedCerts")
+	managedCertsForTLS      = feature("ManagedCertsForTLS")
+	// wildcardManagedCert is reported for an ingress whose managed cert
+	// annotation lists a wildcard domain, which has DNS-authorization
+	// requirements.
+	wildcardManagedCert = feature("WildcardManagedCert")
+	// managedCertLimitRisk is reported for an ingress whose managed cert
+	// count approaches the per-proxy certificate limit.
+	managedCertLimitRisk = feature("ManagedCertLimitRisk")
+	// regionalManagedCertsForTLS is reported for an ingress that uses
+	// regional google managed certs for TLS.
+	regionalManagedCertsForTLS = feature("RegionalManagedCertsForTLS")
+	// conflictingManagedCertScope is reported for an ingress that is
+	// annotated with both global and regional managed certs, which is
+	// nonsensical for a single ingress class.
+	conflictingManagedCertScope = feature("ConflictingManagedCertScope")
+	// externalCertMap is reported for an ingress whose certs are managed via
+	// an external certificate map rather than the built-in cert sources.
+	externalCertMap = feature("ExternalCertMap")
+	staticGlobalIP  = feature("StaticGlobalIP")
+	// malformedStaticIP is reported for an ingress whose static ip annotation
+	// does not parse as an IP literal and hence cannot attach.
+	malformedStaticIP = feature("MalformedStaticIP")
+	// staticIPWithoutTLS is reported for an ingress that reserves a static ip
+	// but does not configure TLS termination.
+	staticIPWithoutTLS = feature("StaticIPWithoutTLS")
+	// staticIPConflict is reported for an ingress whose static ip annotation
+	// names an IP that another tracked ingress references as well; only one of
+	// them can attach it. Computed across ingresses rather than per ingress.
+	staticIPConflict = feature("StaticIPConflict")
+	// dualProtocol is reported for an ingress that serves both plaintext
+	// HTTP and TLS terminated HTTPS traffic.
+	dualProtocol = feature("DualProtocol")
+	// iapWithoutTLS is reported for an ingress that serves plaintext HTTP
+	// while one of its backends enables Cloud IAP.
+	iapWithoutTLS = feature("IAPWithoutTLS")
+	// redirectWithoutHTTP is reported for an ingress whose frontend config
+	// enables https redirects while http serving is disabled, leaving the
+	// redirect target proxy with nothing to redirect.
+	redirectWithoutHTTP = feature("RedirectWithoutHTTP")
+	// redirectingHTTP is reported for an ingress that serves http only to
+	// redirect it to https via its frontend config.
+	redirectingHTTP = feature("RedirectingHTTP")
+	// trafficSplitting is reported for an ingress that configures
+	// traffic-split weights across its backends.
+	trafficSplitting = feature("TrafficSplitting")
+	// customDefaultBackend is reported for an ingress that configures a
+	// custom backend for requests that match no rule via annotation.
+	customDefaultBackend = feature("CustomDefaultBackend")
+	// ingressTimeout is reported for an ingress that configures a request
+	// timeout at the ingress level via annotation.
+	ingressTimeout = feature("IngressTimeout")
+	// emptyExplicitRules is a diagnostic feature reported for an ingress
+	// whose spec carries an explicitly empty rules list as opposed to no
+	// rules at all.
+	emptyExplicitRules = feature("EmptyExplicitRules")
+	// crossNamespaceBackend is reported for an ingress that is backed by a
+	// service port whose service lives in a different namespace.
+	crossNamespaceBackend = feature("CrossNamespaceBackend")
+	// certExpiringSoon is reported for an ingress with a secret-based cert
+	// that expires within certExpiryWindow.
+	certExpiringSoon = feature("CertExpiringSoon")
+	// tlsHostCertMismatch is reported for an ingress that specifies more
+	// distinct TLS hosts than certs, leaving some hosts uncovered.
+	tlsHostCertMismatch = feature("TLSHostCertMismatch")
+	// certNameCollision is reported for an ingress whose spec.TLS secret name
+	// matches the name of one of its managed certs.
+	certNameCollision = feature("CertNameCollision")
+	// weakTLSPolicy is reported for an ingress whose SSL policy permits TLS
+	// versions below 1.2.
+	weakTLSPolicy = feature("WeakTLSPolicy")
 
 	servicePort         = feature("L7LBServicePort")
 	externalServicePort = feature("L7XLBServicePort")
 	internalServicePort = feature("L7ILBServicePort")
 	neg                 = feature("NEG")
+	// h2cBackend is reported for a service port that uses HTTP/2 to the
+	// backend without an encrypted connection.
+	h2cBackend = feature("H2CBackend")
+	// httpsBackend is reported for a service port whose app-protocols
+	// annotation resolves to HTTPS towards the backend.
+	httpsBackend = feature("HTTPSBackend")
+	// negDefaultHealthCheck is reported for a NEG-backed service port that
+	// does not configure a custom health check and hence relies on pod
+	// readiness.
+	negDefaultHealthCheck = feature("NEGDefaultHealthCheck")
+	// negPortMismatch is reported for a NEG-backed service port whose named
+	// port did not resolve to a target port on the service.
+	negPortMismatch = feature("NEGPortMismatch")
+	// negCustomPortName is reported for a NEG-backed service port whose named
+	// port resolved to a target port with a different name.
+	negCustomPortName = feature("NEGCustomPortName")
+	// capacityOverride is reported for a service port whose backend config is
+	// annotated with a max-rate or max-connections capacity override.
+	capacityOverride = feature("CapacityOverride")
 
-	cloudCDN                  = feature("CloudCDN")
-	cloudArmor                = feature("CloudArmor")
-	cloudIAP                  = feature("CloudIAP")
+	cloudCDN = feature("CloudCDN")
+	// cdnBypassHeaders is reported for a CDN-enabled service port that
+	// configures request headers which bypass the cache.
+	cdnBypassHeaders = feature("CDNBypassHeaders")
+	// cdnServeWhileStale is reported for a CDN-enabled service port that
+	// allows stale responses to be served during revalidation.
+	cdnServeWhileStale = feature("CDNServeWhileStale")
+	cloudArmor         = feature("CloudArmor")
+	cloudIAP           = feature("CloudIAP")
+	// iapOpenAccess is reported for a service port that enables Cloud IAP
+	// without OAuth client credentials, leaving access open to any
+	// authenticated Google account.
+	iapOpenAccess = feature("IAPOpenAccess")
+	// cdnWithIap is reported for a service port that enables both Cloud CDN
+	// and Cloud IAP, which risks caching authenticated responses.
+	cdnWithIap                = feature("CDNWithIAP")
 	backendTimeout            = feature("BackendTimeout")
 	backendConnectionDraining = feature("BackendConnectionDraining")
-	clientIPAffinity          = feature("ClientIPAffinity")
-	cookieAffinity            = feature("CookieAffinity")
-	customRequestHeaders      = feature("CustomRequestHeaders")
+	// drainingDisabled is reported for a service port that explicitly
+	// disables connection draining with a zero draining timeout, as opposed
+	// to leaving it unset.
+	drainingDisabled = feature("DrainingDisabled")
+	// drainingTimeoutClamped is reported for a service port whose draining
+	// timeout exceeds the GCE maximum and hence gets clamped silently.
+	drainingTimeoutClamped = feature("DrainingTimeoutClamped")
+	// inconsistentDrainTimeout is reported for a service port whose draining
+	// timeout exceeds its backend timeout, so draining cannot complete within
+	// a single request.
+	inconsistentDrainTimeout = feature("InconsistentDrainTimeout")
+	clientIPAffinity         = feature("ClientIPAffinity")
+	cookieAffinity           = feature("CookieAffinity")
+	// generatedCookieAffinity is reported for the deprecated GENERATED_COOKIE
+	// affinity type specifically, while cookieAffinity will also cover
+	// HTTP_COOKIE once that type is supported.
+	generatedCookieAffinity = feature("GeneratedCookieAffinity")
+	// explicitNoAffinity is reported for a service port that sets the
+	// affinity type to NONE explicitly rather than leaving it unset.
+	explicitNoAffinity = feature("ExplicitNoAffinity")
+	// igAffinity is reported for a service port that configures session
+	// affinity on instance groups, where affinity behaves differently than
+	// on NEGs.
+	igAffinity           = feature("IGAffinity")
+	customRequestHeaders = feature("CustomRequestHeaders")
+	// templatedRequestHeaders is reported for custom request headers whose
+	// value contains a {variable} template token such as {client_ip_address}.
+	templatedRequestHeaders = feature("TemplatedRequestHeaders")
+	// clientCertHeaders is reported for custom request headers that inject
+	// client certificate variables such as {client_cert_present}.
+	clientCertHeaders = feature("ClientCertHeaders")
 
 	standaloneNeg = feature("StandaloneNEG")
 	ingressNeg    = feature("IngressNEG")
 	asmNeg        = feature("AsmNEG")
+	// negReadinessGate is reported for a NEG service whose backing pods use
+	// the NEG readiness gate.
+	negReadinessGate = feature("NEGReadinessGate")
+	// asmNegSubsetting is reported for an ASM NEG service that uses custom
+	// endpoint subsetting.
+	asmNegSubsetting = feature("AsmNEGSubsetting")
 )
 
+// hostNameLengthLimit is the maximum length of a rule host accepted by the
+// GCE URL map.
+const hostNameLengthLimit = 253
+
+// maxDrainingTimeoutSec is the maximum connection draining timeout accepted
+// by GCE backend services. Larger configured values are clamped.
+const maxDrainingTimeoutSec = 3600
+
+// certExpiryWindow is the window within which an upcoming cert expiry is
+// reported as certExpiringSoon.
+var certExpiryWindow = 30 * 24 * time.Hour
+
+// managedCertWarningThreshold is the managed cert count above which an
+// ingress is reported as approaching the per-proxy certificate limit.
+const managedCertWarningThreshold = 10
+
+// alphaIngressClassName is the ingress class that marks an ingress as using
+// the preview ingress implementation. A variable so the class name can be
+// adjusted while the preview is renamed between releases.
+var alphaIngressClassName = "gce-alpha"
+
 // featuresForIngress returns the list of features for given ingress.
 func featuresForIngress(ing *v1beta1.Ingress) []feature {
 	features := []feature{ingress}
@@ -92,13 +305,28 @@ func featuresForIngress(ing *v1beta1.Ingress) []feature {
 	switch ingClass {
 	case "", gceIngressClass, gceMultiIngressClass:
 		features = append(features, externalIngress)
+		if _, ok := ingAnnotations[globalAccessKey]; ok {
+			// The class annotation wins, the ingress stays external.
+			klog.V(6).Infof("Internal-only annotation %s is set on external ingress %s", globalAccessKey, ingKey)
+			features = append(features, conflictingIngressClass)
+		}
 	case gceL7ILBIngressClass:
 		features = append(features, internalIngress)
+		if enabled, err := strconv.ParseBool(ingAnnotations[globalAccessKey]); err == nil && enabled {
+			klog.V(6).Infof("Global access is enabled for internal ingress %s", ingKey)
+			features = append(features, ilbGlobalAccess)
+		}
+	}
+	if ingClass != "" && ingClass == alphaIngressClassName {
+		klog.V(6).Infof("Ingress %s uses the alpha ingress class %s", ingKey, ingClass)
+		features = append(features, alphaIngressClass)
 	}
 
 	// Determine if http is enabled.
+	httpOn := false
 	if val, ok := ingAnnotations[allowHTTPKey]; !ok {
 		klog.V(6).Infof("Annotation %s does not exist for ingress %s", allowHTTPKey, ingKey)
+		httpOn = true
 		features = append(features, httpEnabled)
 	} else {
 		klog.V(6).Infof("User specified value for annotation %s on ingress %s: %s", allowHTTPKey, ingKey, val)
@@ -107,14 +335,20 @@ func featuresForIngress(ing *v1beta1.Ingress) []feature {
 			klog.Errorf("Failed to parse %s for annotation %s on ingress %s", val, allowHTTPKey, ingKey)
 		}
 		if err == nil && v {
+			httpOn = true
 			features = append(features, httpEnabled)
 		}
 	}
 
 	// An ingress without a host or http-path is ignored.
-	hostBased, pathBased := false, false
+	hostBased, pathBased, longHost, hostlessPaths := false, false, false, false
 	if len(ing.Spec.Rules) == 0 {
 		klog.V(6).Infof("Neither host-based nor path-based routing rules are setup for ingress %s", ingKey)
+		// Distinguish an explicitly empty rules list from an absent one.
+		if ing.Spec.Rules != nil {
+			klog.V(6).Infof("Explicitly empty rules list is setup for ingress %s", ingKey)
+			features = append(features, emptyExplicitRules)
+		}
 	}
 	for _, rule := range ing.Spec.Rules {
 		if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
@@ -124,8 +358,15 @@ func featuresForIngress(ing *v1beta1.Ingress) []feature {
 		if rule.Host != "" {
 			klog.V(6).Infof("User specified host for ingress %s: %v", ingKey, rule.Host)
 			hostBased = true
+			if len(rule.Host) > hostNameLengthLimit {
+				klog.V(6).Infof("Host %q of ingress %s exceeds the length limit of %d", rule.Host, ingKey, hostNameLengthLimit)
+				longHost = true
+			}
+		} else if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			klog.V(6).Infof("Hostless path rule of ingress %s applies to all hosts", ingKey)
+			hostlessPaths = true
 		}
-		if pathBased && hostBased {
+		if pathBased && hostBased && longHost && hostlessPaths {
 			break
 		}
 	}
@@ -135,6 +376,12 @@ func featuresForIngress(ing *v1beta1.Ingress) []feature {
 	if pathBased {
 		features = append(features, pathBasedRouting)
 	}
+	if longHost {
+		features = append(features, hostNameTooLong)
+	}
+	if hostlessPaths {
+		features = append(features, hostlessPathRules)
+	}
 
 	// SSL certificate based features.
 	sslConfigured := false
@@ -142,30 +389,285 @@ func featuresForIngress(ing *v1beta1.Ingress) []feature {
 		klog.V(6).Infof("Specified pre-shared certs for ingress %s: %v", ingKey, val)
 		sslConfigured = true
 		features = append(features, preSharedCertsForTLS)
+		if hasDuplicateCerts(parseCertList(val)) {
+			klog.V(6).Infof("Duplicate pre-shared cert names are specified for ingress %s: %v", ingKey, val)
+			features = append(features, duplicatePreSharedCerts)
+		}
 	}
 	if val, ok := ingAnnotations[managedCertKey]; ok {
 		klog.V(6).Infof("Specified google managed certs for ingress %s: %v", ingKey, val)
 		sslConfigured = true
 		features = append(features, managedCertsForTLS)
+		certs := parseCertList(val)
+		for _, cert := range certs {
+			if strings.Contains(cert, "*") {
+				klog.V(6).Infof("Wildcard managed cert %q is specified for ingress %s", cert, ingKey)
+				features = append(features, wildcardManagedCert)
+				break
+			}
+		}
+		if len(certs) > managedCertWarningThreshold {
+			klog.V(6).Infof("Ingress %s specifies %d managed certs, approaching the per-proxy limit", ingKey, len(certs))
+			features = append(features, managedCertLimitRisk)
+		}
+	}
+	if val, ok := ingAnnotations[regionalManagedCertKey]; ok {
+		klog.V(6).Infof("Specified regional google managed certs for ingress %s: %v", ingKey, val)
+		sslConfigured = true
+		features = append(features, regionalManagedCertsForTLS)
+		if _, ok := ingAnnotations[managedCertKey]; ok {
+			klog.V(6).Infof("Both global and regional managed certs are specified for ingress %s", ingKey)
+			features = append(features, conflictingManagedCertScope)
+		}
 	}
 	if hasSecretBasedCerts(ing) {
 		sslConfigured = true
 		features = append(features, secretBasedCertsForTLS)
+		if hasCrossNamespaceSecret(ing) {
+			features = append(features, crossNamespaceSecret)
+		}
 	}
 	if sslConfigured {
 		klog.V(6).Infof("TLS termination is configured for ingress %s", ingKey)
 		features = append(features, tlsTermination)
+		if httpOn {
+			klog.V(6).Infof("Both http and https are served for ingress %s", ingKey)
+			features = append(features, dualProtocol)
+		}
+		tlsHosts := make(map[string]bool)
+		certCount := len(parseCertList(ingAnnotations[preSharedCertKey])) +
+			len(parseCertList(ingAnnotations[managedCertKey])) +
+			len(parseCertList(ingAnnotations[regionalManagedCertKey]))
+		for _, tlsConfig := range ing.Spec.TLS {
+			for _, host := range tlsConfig.Hosts {
+				tlsHosts[host] = true
+			}
+			if tlsConfig.SecretName != "" {
+				certCount++
+			}
+		}
+		if len(tlsHosts) > certCount {
+			klog.V(6).Infof("Ingress %s specifies %d distinct TLS hosts but only %d certs", ingKey, len(tlsHosts), certCount)
+			features = append(features, tlsHostCertMismatch)
+		}
+		managedCertNames := make(map[string]bool)
+		for _, cert := range parseCertList(ingAnnotations[managedCertKey]) {
+			managedCertNames[cert] = true
+		}
+		for _, tlsConfig := range ing.Spec.TLS {
+			if managedCertNames[tlsConfig.SecretName] {
+				klog.V(6).Infof("TLS secret name %q of ingress %s collides with a managed cert name", tlsConfig.SecretName, ingKey)
+				features = append(features, certNameCollision)
+				break
+			}
+		}
+	}
+	if val, ok := ingAnnotations[certMapKey]; ok && val != "" {
+		klog.V(6).Infof("Specified certificate map for ingress %s: %s", ingKey, val)
+		features = append(features, externalCertMap)
 	}
 
 	// Both user specified and ingress controller managed global static ips are reported.
 	if val, ok := ingAnnotations[staticIPKey]; ok && val != "" {
 		klog.V(6).Infof("Specified static for ingress %s: %s", ingKey, val)
 		features = append(features, staticGlobalIP)
+		if net.ParseIP(val) == nil {
+			klog.V(6).Infof("Static ip %q of ingress %s is not a valid IP literal", val, ingKey)
+			features = append(features, malformedStaticIP)
+		}
+		if !sslConfigured {
+			klog.V(6).Infof("Static ip is specified for ingress %s without TLS termination", ingKey)
+			features = append(features, staticIPWithoutTLS)
+		}
+	}
+
+	// Traffic-split weights are currently annotation based only. Detection via
+	// a BackendConfig field can hook in here once such a field exists.
+	if val, ok := ingAnnotations[trafficSplitKey]; ok {
+		klog.V(6).Infof("Specified traffic-split weights for ingress %s: %s", ingKey, val)
+		features = append(features, trafficSplitting)
+	}
+
+	if val, ok := ingAnnotations[customDefaultBackendKey]; ok {
+		klog.V(6).Infof("Specified custom default backend for ingress %s: %s", ingKey, val)
+		features = append(features, customDefaultBackend)
+	}
+
+	if val, ok := ingAnnotations[ingressTimeoutKey]; ok {
+		klog.V(6).Infof("Specified request timeout for ingress %s: %s", ingKey, val)
+		features = append(features, ingressTimeout)
+	}
+
+	// Backend service ports can be referenced by name or by number.
+	namedPorts, numberedPorts := false, false
+	notePortType := func(port intstr.IntOrString) {
+		if port.Type == intstr.String {
+			namedPorts = true
+		} else {
+			numberedPorts = true
+		}
+	}
+	if ing.Spec.Backend != nil {
+		notePortType(ing.Spec.Backend.ServicePort)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			notePortType(path.Backend.ServicePort)
+		}
+	}
+	if namedPorts {
+		klog.V(6).Infof("Ingress %s references a service port by name", ingKey)
+		features = append(features, namedServicePort)
+	}
+	if numberedPorts {
+		klog.V(6).Infof("Ingress %s references a service port by number", ingKey)
+		features = append(features, numberedServicePort)
 	}
 	klog.V(4).Infof("Features for ingress %s/%s: %v", ing.Namespace, ing.Name, features)
 	return features
 }
 
+// featuresForIngressState returns the combined set of frontend and backend
+// based features for given ingress state. Service specific features are not
+// attributed to the ingress.
+func featuresForIngressState(ingState IngressState) map[feature]bool {
+	features := make(map[feature]bool)
+	for _, ftr := range featuresForIngress(ingState.ingress) {
+		features[ftr] = true
+	}
+	for _, svcPort := range ingState.servicePorts {
+		for _, ftr := range featuresForServicePort(svcPort) {
+			if !isServiceFeature(ftr) {
+				features[ftr] = true
+			}
+		}
+	}
+	addCorrelationFeatures(features, ingState)
+	return features
+}
+
+// FeaturesForIngressState returns the frontend based features of the given
+// ingress state and the combined backend based features of its service ports,
+// without touching any ControllerMetrics instance. Backend features shared by
+// multiple service ports are listed once.
+func FeaturesForIngressState(s IngressState) (frontend, backend []feature) {
+	frontend = featuresForIngress(s.ingress)
+	seen := make(map[feature]bool)
+	for _, svcPort := range s.servicePorts {
+		for _, ftr := range featuresForServicePort(svcPort) {
+			if seen[ftr] {
+				continue
+			}
+			seen[ftr] = true
+			backend = append(backend, ftr)
+		}
+	}
+	return frontend, backend
+}
+
+// addCorrelationFeatures adds features that are computed by correlating the
+// frontend and backend based features of an ingress.
+func addCorrelationFeatures(features map[feature]bool, ingState IngressState) {
+	ingKey := fmt.Sprintf("%s/%s", ingState.ingress.Namespace, ingState.ingress.Name)
+	if features[cloudIAP] && features[httpEnabled] && !features[tlsTermination] {
+		klog.V(6).Infof("Cloud IAP is enabled without TLS termination for ingress %s", ingKey)
+		features[iapWithoutTLS] = true
+	}
+	if feConfig := ingState.frontendconfig; feConfig != nil && feConfig.Spec.RedirectToHttps != nil &&
+		feConfig.Spec.RedirectToHttps.Enabled {
+		if features[httpEnabled] {
+			klog.V(6).Infof("Http traffic is redirected to https for ingress %s", ingKey)
+			features[redirectingHTTP] = true
+		} else {
+			klog.V(6).Infof("Https redirect is enabled without http serving for ingress %s", ingKey)
+			features[redirectWithoutHTTP] = true
+		}
+	}
+	for _, svcPort := range ingState.servicePorts {
+		if svcNamespace := svcPort.ID.Service.Namespace; svcNamespace != "" && svcNamespace != ingState.ingress.Namespace {
+			klog.V(6).Infof("Service %s backing ingress %s is in a different namespace", svcPort.ID.Service, ingKey)
+			features[crossNamespaceBackend] = true
+			break
+		}
+	}
+	if minVersion := ingState.sslPolicyMinTLSVersion; minVersion == "TLS_1_0" || minVersion == "TLS_1_1" {
+		klog.V(6).Infof("SSL policy of ingress %s permits TLS versions below 1.2: %s", ingKey, minVersion)
+		features[weakTLSPolicy] = true
+	}
+	expiryCutoff := time.Now().Add(certExpiryWindow)
+	for _, expiry := range ingState.certExpiries {
+		if !expiry.IsZero() && expiry.Before(expiryCutoff) {
+			klog.V(6).Infof("A cert of ingress %s expires at %v, within the %v expiry window", ingKey, expiry, certExpiryWindow)
+			features[certExpiringSoon] = true
+			break
+		}
+	}
+}
+
+// parseCertList parses a comma-separated certificate annotation value into
+// the list of certificate names, ignoring surrounding whitespace and empty
+// entries.
+func parseCertList(val string) []string {
+	var certs []string
+	for _, cert := range strings.Split(val, ",") {
+		cert = strings.TrimSpace(cert)
+		if cert == "" {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// hasDuplicateCerts returns true if given certificate name list contains the
+// same name more than once.
+func hasDuplicateCerts(certs []string) bool {
+	seen := make(map[string]bool, len(certs))
+	for _, cert := range certs {
+		if seen[cert] {
+			return true
+		}
+		seen[cert] = true
+	}
+	return false
+}
+
+// hasSecureBackendHealthCheck returns true if the custom health check for
+// given service port indicates an encrypted connection to the backend.
+func hasSecureBackendHealthCheck(sp utils.ServicePort) bool {
+	if sp.BackendConfig == nil || sp.BackendConfig.Spec.HealthCheck == nil || sp.BackendConfig.Spec.HealthCheck.Type == nil {
+		return false
+	}
+	healthCheckType := *sp.BackendConfig.Spec.HealthCheck.Type
+	return healthCheckType == "HTTPS" || healthCheckType == "HTTP2"
+}
+
+// hasTemplateToken returns true if given header value contains a "{...}"
+// template token.
+func hasTemplateToken(header string) bool {
+	open := strings.Index(header, "{")
+	return open >= 0 && strings.Index(header[open:], "}") > 0
+}
+
+// hasCrossNamespaceSecret returns true if a TLS secret name of given ingress
+// carries a namespace qualifier pointing outside the ingress namespace.
+func hasCrossNamespaceSecret(ing *v1beta1.Ingress) bool {
+	for _, tlsSecret := range ing.Spec.TLS {
+		slash := strings.Index(tlsSecret.SecretName, "/")
+		if slash < 0 {
+			continue
+		}
+		if secretNamespace := tlsSecret.SecretName[:slash]; secretNamespace != ing.Namespace {
+			klog.V(6).Infof("Cross-namespace secret for ingress %s/%s: %s", ing.Namespace, ing.Name, tlsSecret.SecretName)
+			return true
+		}
+	}
+	return false
+}
+
 // hasSecretBasedCerts returns true if ingress spec contains a secret based cert.
 func hasSecretBasedCerts(ing *v1beta1.Ingress) bool {
 	for _, tlsSecret := range ing.Spec.TLS {
@@ -192,6 +694,26 @@ func featuresForServicePort(sp utils.ServicePort) []feature {
 	if sp.NEGEnabled {
 		klog.V(6).Infof("NEG is enabled for service port %s", svcPortKey)
 		features = append(features, neg)
+		if sp.BackendConfig == nil || sp.BackendConfig.Spec.HealthCheck == nil {
+			klog.V(6).Infof("No custom health check is configured for NEG-backed service port %s", svcPortKey)
+			features = append(features, negDefaultHealthCheck)
+		}
+		if sp.ID.Port.Type == intstr.String && sp.TargetPort == "" {
+			klog.V(6).Infof("Named port %s of NEG-backed service port %s did not resolve to a target port", sp.ID.Port.String(), svcPortKey)
+			features = append(features, negPortMismatch)
+		}
+		if sp.ID.Port.Type == intstr.String && sp.TargetPort != "" && sp.TargetPort != sp.ID.Port.String() {
+			klog.V(6).Infof("Named port %s of NEG-backed service port %s resolved to a different target port %s", sp.ID.Port.String(), svcPortKey, sp.TargetPort)
+			features = append(features, negCustomPortName)
+		}
+	}
+	if sp.Protocol == annotations.ProtocolHTTP2 && !hasSecureBackendHealthCheck(sp) {
+		klog.V(6).Infof("HTTP/2 cleartext backend is configured for service port %s", svcPortKey)
+		features = append(features, h2cBackend)
+	}
+	if sp.Protocol == annotations.ProtocolHTTPS {
+		klog.V(6).Infof("HTTPS backend protocol is configured for service port %s", svcPortKey)
+		features = append(features, httpsBackend)
 	}
 	if sp.BackendConfig == nil {
 		klog.V(4).Infof("Features for Service port %s: %v", svcPortKey, features)
@@ -201,24 +723,59 @@ func featuresForServicePort(sp utils.ServicePort) []feature {
 	beConfig := fmt.Sprintf("%s/%s", sp.BackendConfig.Namespace, sp.BackendConfig.Name)
 	klog.V(6).Infof("Backend config specified for service port %s: %s", svcPortKey, beConfig)
 
+	// Capacity overrides are currently annotation based only. Detection via
+	// BackendConfig fields can hook in here once such fields exist.
+	for _, key := range []string{maxRatePerEndpointKey, maxConnectionsKey} {
+		if val, ok := sp.BackendConfig.Annotations[key]; ok {
+			klog.V(6).Infof("Capacity override %s=%s is configured for service port %s", key, val, svcPortKey)
+			features = append(features, capacityOverride)
+			break
+		}
+	}
+
 	if sp.BackendConfig.Spec.Cdn != nil && sp.BackendConfig.Spec.Cdn.Enabled {
 		klog.V(6).Infof("Cloud CDN is enabled for service port %s", svcPortKey)
 		features = append(features, cloudCDN)
+		if len(sp.BackendConfig.Spec.Cdn.BypassCacheOnRequestHeaders) > 0 {
+			klog.V(6).Infof("Cache bypass request headers are configured for service port %s", svcPortKey)
+			features = append(features, cdnBypassHeaders)
+		}
+		if sp.BackendConfig.Spec.Cdn.ServeWhileStale > 0 {
+			klog.V(6).Infof("Serve while stale is configured for service port %s", svcPortKey)
+			features = append(features, cdnServeWhileStale)
+		}
 	}
 	if sp.BackendConfig.Spec.Iap != nil && sp.BackendConfig.Spec.Iap.Enabled {
 		klog.V(6).Infof("Cloud IAP is enabled for service port %s", svcPortKey)
 		features = append(features, cloudIAP)
+		if sp.BackendConfig.Spec.Iap.OAuthClientCredentials == nil {
+			klog.V(6).Infof("Cloud IAP is enabled without OAuth client credentials for service port %s", svcPortKey)
+			features = append(features, iapOpenAccess)
+		}
+		if sp.BackendConfig.Spec.Cdn != nil && sp.BackendConfig.Spec.Cdn.Enabled {
+			klog.V(6).Infof("Both Cloud CDN and Cloud IAP are enabled for service port %s", svcPortKey)
+			features = append(features, cdnWithIap)
+		}
 	}
 	// Possible list of Affinity types:
 	// NONE, CLIENT_IP, GENERATED_COOKIE, CLIENT_IP_PROTO, or CLIENT_IP_PORT_PROTO.
 	if sp.BackendConfig.Spec.SessionAffinity != nil {
 		affinityType := sp.BackendConfig.Spec.SessionAffinity.AffinityType
+		affinityConfigured := false
 		switch affinityType {
+		case "NONE":
+			features = append(features, explicitNoAffinity)
 		case "GENERATED_COOKIE":
-			features = append(features, cookieAffinity)
+			affinityConfigured = true
+			features = append(features, cookieAffinity, generatedCookieAffinity)
 		case "CLIENT_IP", "CLIENT_IP_PROTO", "CLIENT_IP_PORT_PROTO":
+			affinityConfigured = true
 			features = append(features, clientIPAffinity)
 		}
+		if affinityConfigured && !sp.NEGEnabled {
+			klog.V(6).Infof("Session affinity is configured on instance groups for service port %s", svcPortKey)
+			features = append(features, igAffinity)
+		}
 		klog.V(6).Infof("Session affinity %s is configured for service port %s", affinityType, svcPortKey)
 	}
 	if sp.BackendConfig.Spec.SecurityPolicy != nil {
@@ -230,12 +787,39 @@ func featuresForServicePort(sp utils.ServicePort) []feature {
 		features = append(features, backendTimeout)
 	}
 	if sp.BackendConfig.Spec.ConnectionDraining != nil {
-		klog.V(6).Infof("Backend connection draining(%v secs) is configured for service port %s", sp.BackendConfig.Spec.ConnectionDraining.DrainingTimeoutSec, svcPortKey)
-		features = append(features, backendConnectionDraining)
+		if drainingTimeoutSec := sp.BackendConfig.Spec.ConnectionDraining.DrainingTimeoutSec; drainingTimeoutSec > 0 {
+			klog.V(6).Infof("Backend connection draining(%v secs) is configured for service port %s", drainingTimeoutSec, svcPortKey)
+			features = append(features, backendConnectionDraining)
+			if drainingTimeoutSec > maxDrainingTimeoutSec {
+				klog.V(6).Infof("Draining timeout for service port %s exceeds the maximum of %d secs", svcPortKey, maxDrainingTimeoutSec)
+				features = append(features, drainingTimeoutClamped)
+			}
+			if sp.BackendConfig.Spec.TimeoutSec != nil && drainingTimeoutSec > *sp.BackendConfig.Spec.TimeoutSec {
+				klog.V(6).Infof("Draining timeout(%v secs) for service port %s exceeds its backend timeout(%v secs)", drainingTimeoutSec, svcPortKey, *sp.BackendConfig.Spec.TimeoutSec)
+				features = append(features, inconsistentDrainTimeout)
+			}
+		} else {
+			klog.V(6).Infof("Backend connection draining is explicitly disabled for service port %s", svcPortKey)
+			features = append(features, drainingDisabled)
+		}
 	}
 	if sp.BackendConfig.Spec.CustomRequestHeaders != nil {
 		klog.V(6).Infof("Custom request headers configured for service port %s: %v", svcPortKey, sp.BackendConfig.Spec.CustomRequestHeaders.Headers)
 		features = append(features, customRequestHeaders)
+		for _, header := range sp.BackendConfig.Spec.CustomRequestHeaders.Headers {
+			if hasTemplateToken(header) {
+				klog.V(6).Infof("Custom request header %q for service port %s uses a template token", header, svcPortKey)
+				features = append(features, templatedRequestHeaders)
+				break
+			}
+		}
+		for _, header := range sp.BackendConfig.Spec.CustomRequestHeaders.Headers {
+			if strings.Contains(header, "{client_cert") {
+				klog.V(6).Infof("Custom request header %q for service port %s injects client certificate info", header, svcPortKey)
+				features = append(features, clientCertHeaders)
+				break
+			}
+		}
 	}
 	klog.V(4).Infof("Features for Service port %s: %v", svcPortKey, features)
 	return features
@@ -18,12 +18,17 @@ package metrics
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/ingress-gce/pkg/annotations"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
@@ -68,18 +73,58 @@ func NewIngressState(ing *v1beta1.Ingress, svcPorts []utils.ServicePort) Ingress
 	return IngressState{ingress: ing, servicePorts: svcPorts}
 }
 
+// NewIngressStateWithFrontendConfig returns ingress state for given ingress,
+// its associated frontend config and service ports.
+func NewIngressStateWithFrontendConfig(ing *v1beta1.Ingress, feConfig *frontendconfigv1beta1.FrontendConfig, svcPorts []utils.ServicePort) IngressState {
+	return IngressState{ingress: ing, frontendconfig: feConfig, servicePorts: svcPorts}
+}
+
 // ControllerMetrics contains the state of the all ingresses.
 type ControllerMetrics struct {
 	// ingressMap is a map between ingress key to ingress state
 	ingressMap map[string]IngressState
+	// ingressUpdateTime is a map between ingress key to the time its state
+	// was last updated.
+	ingressUpdateTime map[string]time.Time
 	// negMap is a map between service key to neg state
 	negMap map[string]NegServiceState
+	// negCountChanges is a map between neg type to the number of times the
+	// count of that type changed for an already tracked service.
+	negCountChanges map[feature]int
+	// ingressErrors is a map between ingress key to the number of sync errors
+	// recorded for it.
+	ingressErrors map[string]int
+	// featureFirstSeen is a map between feature to the time it was first
+	// observed on any tracked ingress.
+	featureFirstSeen map[feature]time.Time
+	// featureAliases is a map between deprecated metric name to the feature
+	// it was renamed to. Exports emit both names during a deprecation window.
+	featureAliases map[string]feature
+	// featureHistory is a map between feature to its most recently computed
+	// ingress counts, retained up to historySize values per feature.
+	featureHistory map[feature][]int
+	// historySize is the number of computed counts retained per feature.
+	// Zero disables history collection.
+	historySize int
+	// lastSnapshotCounts is the combined feature counts remembered by the
+	// previous DeltaSinceLastSnapshot call.
+	lastSnapshotCounts map[feature]int
+	clock              clock.Clock
 	sync.Mutex
 }
 
 // NewControllerMetrics initializes ControllerMetrics and starts a go routine to compute and export metrics periodically.
 func NewControllerMetrics() *ControllerMetrics {
-	return &ControllerMetrics{ingressMap: make(map[string]IngressState), negMap: make(map[string]NegServiceState)}
+	return &ControllerMetrics{
+		ingressMap:        make(map[string]IngressState),
+		ingressUpdateTime: make(map[string]time.Time),
+		negMap:            make(map[string]NegServiceState),
+		negCountChanges:   make(map[feature]int),
+		ingressErrors:     make(map[string]int),
+		featureFirstSeen:  make(map[feature]time.Time),
+		featureAliases:    make(map[string]feature),
+		clock:             clock.RealClock{},
+	}
 }
 
 // servicePortKey defines a service port uniquely.
@@ -120,6 +165,37 @@ func (im *ControllerMetrics) SetIngress(ingKey string, ing IngressState) {
 		klog.Fatalf("Ingress Metrics failed to initialize correctly.")
 	}
 	im.ingressMap[ingKey] = ing
+	im.ingressUpdateTime[ingKey] = im.clock.Now()
+	im.recordFirstSeen(ing)
+}
+
+// recordFirstSeen records the current time for every feature of the given
+// ingress state that has not been observed before. Callers must hold im.Lock.
+func (im *ControllerMetrics) recordFirstSeen(ing IngressState) {
+	now := im.clock.Now()
+	for ftr := range featuresForIngressState(ing) {
+		if _, ok := im.featureFirstSeen[ftr]; !ok {
+			im.featureFirstSeen[ftr] = now
+		}
+	}
+	for _, svcPort := range ing.servicePorts {
+		for _, ftr := range featuresForServicePort(svcPort) {
+			if _, ok := im.featureFirstSeen[ftr]; !ok {
+				im.featureFirstSeen[ftr] = now
+			}
+		}
+	}
+}
+
+// FeatureFirstSeen returns the time the given feature was first observed on
+// any tracked ingress. The second return value reports whether the feature
+// has been observed at all.
+func (im *ControllerMetrics) FeatureFirstSeen(ftr feature) (time.Time, bool) {
+	im.Lock()
+	defer im.Unlock()
+
+	firstSeen, ok := im.featureFirstSeen[ftr]
+	return firstSeen, ok
 }
 
 // DeleteIngress implements IngressMetricsCollector.
@@ -128,6 +204,134 @@ func (im *ControllerMetrics) DeleteIngress(ingKey string) {
 	defer im.Unlock()
 
 	delete(im.ingressMap, ingKey)
+	delete(im.ingressUpdateTime, ingKey)
+	delete(im.ingressErrors, ingKey)
+}
+
+// GetIngressState returns a copy of the tracked state for the given ingress
+// key. The copy does not share the ingress, frontend config or backend config
+// pointers with the collector, so callers are free to mutate it; only the
+// backend namer of each service port is shared. The second return value
+// reports whether the key is tracked.
+func (im *ControllerMetrics) GetIngressState(ingKey string) (IngressState, bool) {
+	im.Lock()
+	defer im.Unlock()
+
+	ingState, ok := im.ingressMap[ingKey]
+	if !ok {
+		return IngressState{}, false
+	}
+	stateCopy := ingState
+	if ingState.ingress != nil {
+		stateCopy.ingress = ingState.ingress.DeepCopy()
+	}
+	if ingState.frontendconfig != nil {
+		stateCopy.frontendconfig = ingState.frontendconfig.DeepCopy()
+	}
+	stateCopy.servicePorts = append([]utils.ServicePort(nil), ingState.servicePorts...)
+	for i := range stateCopy.servicePorts {
+		if backendConfig := stateCopy.servicePorts[i].BackendConfig; backendConfig != nil {
+			stateCopy.servicePorts[i].BackendConfig = backendConfig.DeepCopy()
+		}
+	}
+	return stateCopy, true
+}
+
+// IngressKeys returns a sorted copy of all tracked ingress keys.
+func (im *ControllerMetrics) IngressKeys() []string {
+	im.Lock()
+	defer im.Unlock()
+
+	keys := make([]string, 0, len(im.ingressMap))
+	for ingKey := range im.ingressMap {
+		keys = append(keys, ingKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReconcileAgainst compares the tracked ingress keys to the given
+// authoritative list of live keys. It returns the live keys that are not
+// tracked yet and the tracked keys that are no longer live, both sorted by
+// name. If prune is set, the stale entries are dropped from tracking.
+func (im *ControllerMetrics) ReconcileAgainst(keys []string, prune bool) (added, removed []string) {
+	im.Lock()
+	defer im.Unlock()
+
+	liveKeys := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		liveKeys[key] = true
+		if _, ok := im.ingressMap[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	for ingKey := range im.ingressMap {
+		if liveKeys[ingKey] {
+			continue
+		}
+		removed = append(removed, ingKey)
+		if prune {
+			klog.V(4).Infof("Pruning ingress %s, which is no longer live", ingKey)
+			delete(im.ingressMap, ingKey)
+			delete(im.ingressUpdateTime, ingKey)
+			delete(im.ingressErrors, ingKey)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// RecordIngressError records a sync error for the given ingress key.
+func (im *ControllerMetrics) RecordIngressError(ingKey string) {
+	im.Lock()
+	defer im.Unlock()
+
+	klog.V(6).Infof("Recording sync error for ingress %s", ingKey)
+	im.ingressErrors[ingKey]++
+}
+
+// computeFeatureErrorRates returns, for each feature present on at least one
+// tracked ingress, the fraction of ingresses with that feature that have sync
+// errors recorded.
+func (im *ControllerMetrics) computeFeatureErrorRates() map[feature]float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	withFeature := make(map[feature]int)
+	withErrorAndFeature := make(map[feature]int)
+	for ingKey, ingState := range im.ingressMap {
+		errored := im.ingressErrors[ingKey] > 0
+		for ftr := range featuresForIngressState(ingState) {
+			withFeature[ftr]++
+			if errored {
+				withErrorAndFeature[ftr]++
+			}
+		}
+	}
+	errorRates := make(map[feature]float64, len(withFeature))
+	for ftr, count := range withFeature {
+		errorRates[ftr] = float64(withErrorAndFeature[ftr]) / float64(count)
+	}
+	return errorRates
+}
+
+// OldestIngressStateAge returns the age of the least recently updated ingress
+// state. Returns 0 if no ingress state is tracked.
+func (im *ControllerMetrics) OldestIngressStateAge() time.Duration {
+	im.Lock()
+	defer im.Unlock()
+
+	var oldest time.Time
+	for _, updateTime := range im.ingressUpdateTime {
+		if oldest.IsZero() || updateTime.Before(oldest) {
+			oldest = updateTime
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return im.clock.Now().Sub(oldest)
 }
 
 // SetIngress implements NegMetricsCollector.
@@ -138,6 +342,20 @@ func (im *ControllerMetrics) SetNegService(svcKey string, negState NegServiceSta
 	if im.negMap == nil {
 		klog.Fatalf("Ingress Metrics failed to initialize correctly.")
 	}
+	if prevState, ok := im.negMap[svcKey]; ok {
+		if prevState.StandaloneNeg != negState.StandaloneNeg {
+			klog.V(6).Infof("Standalone NEG count of service %s changed from %d to %d", svcKey, prevState.StandaloneNeg, negState.StandaloneNeg)
+			im.negCountChanges[standaloneNeg]++
+		}
+		if prevState.IngressNeg != negState.IngressNeg {
+			klog.V(6).Infof("Ingress NEG count of service %s changed from %d to %d", svcKey, prevState.IngressNeg, negState.IngressNeg)
+			im.negCountChanges[ingressNeg]++
+		}
+		if prevState.AsmNeg != negState.AsmNeg {
+			klog.V(6).Infof("ASM NEG count of service %s changed from %d to %d", svcKey, prevState.AsmNeg, negState.AsmNeg)
+			im.negCountChanges[asmNeg]++
+		}
+	}
 	im.negMap[svcKey] = negState
 }
 
@@ -149,22 +367,86 @@ func (im *ControllerMetrics) DeleteNegService(svcKey string) {
 	delete(im.negMap, svcKey)
 }
 
+// RegisterFeatureAlias maps a deprecated metric name to the feature it was
+// renamed to. Exports emit the counts of the feature under both names so that
+// downstream dashboards keep working during a deprecation window.
+func (im *ControllerMetrics) RegisterFeatureAlias(oldName string, ftr feature) {
+	im.Lock()
+	defer im.Unlock()
+
+	klog.V(3).Infof("Registering feature alias %s for %s", oldName, ftr)
+	im.featureAliases[oldName] = ftr
+}
+
+// EnableHistory starts retaining the last size computed ingress counts of
+// every feature for trend graphs. Any previously retained history is dropped.
+func (im *ControllerMetrics) EnableHistory(size int) {
+	im.Lock()
+	defer im.Unlock()
+
+	klog.V(3).Infof("Retaining the last %d computed counts per feature", size)
+	im.historySize = size
+	im.featureHistory = make(map[feature][]int)
+}
+
+// FeatureHistory returns the retained computed ingress counts of the given
+// feature, oldest first.
+func (im *ControllerMetrics) FeatureHistory(ftr feature) []int {
+	im.Lock()
+	defer im.Unlock()
+
+	history := im.featureHistory[ftr]
+	return append([]int(nil), history...)
+}
+
+// recordFeatureHistory appends the given computed ingress counts to the
+// per-feature history, trimming each to the configured size. Callers must
+// hold im.Lock.
+func (im *ControllerMetrics) recordFeatureHistory(counts map[feature]int) {
+	if im.historySize == 0 {
+		return
+	}
+	for ftr, count := range counts {
+		history := append(im.featureHistory[ftr], count)
+		if len(history) > im.historySize {
+			history = history[len(history)-im.historySize:]
+		}
+		im.featureHistory[ftr] = history
+	}
+}
+
+// aliasedCounts converts a feature count map into the string-keyed form used
+// for exports, duplicating the counts of renamed features under their
+// registered deprecated names.
+func (im *ControllerMetrics) aliasedCounts(counts map[feature]int) map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	out := featureCountsToStrings(counts)
+	for oldName, ftr := range im.featureAliases {
+		if count, ok := counts[ftr]; ok {
+			out[oldName] = count
+		}
+	}
+	return out
+}
+
 // export computes and exports ingress usage metrics.
 func (im *ControllerMetrics) export() {
 	ingCount, svcPortCount := im.computeIngressMetrics()
 	negCount := im.computeNegMetrics()
 
 	klog.V(3).Infof("Exporting ingress usage metrics. Ingress Count: %#v, Service Port count: %#v, NEG count: %#v", ingCount, svcPortCount, negCount)
-	for feature, count := range ingCount {
-		ingressCount.With(prometheus.Labels{label: feature.String()}).Set(float64(count))
+	for feature, count := range im.aliasedCounts(ingCount) {
+		ingressCount.With(prometheus.Labels{label: feature}).Set(float64(count))
 	}
 
-	for feature, count := range svcPortCount {
-		servicePortCount.With(prometheus.Labels{label: feature.String()}).Set(float64(count))
+	for feature, count := range im.aliasedCounts(svcPortCount) {
+		servicePortCount.With(prometheus.Labels{label: feature}).Set(float64(count))
 	}
 
-	for feature, count := range negCount {
-		networkEndpointGroupCount.With(prometheus.Labels{label: feature.String()}).Set(float64(count))
+	for feature, count := range im.aliasedCounts(negCount) {
+		networkEndpointGroupCount.With(prometheus.Labels{label: feature}).Set(float64(count))
 	}
 	klog.V(3).Infof("Ingress usage metrics exported.")
 }
@@ -181,6 +463,9 @@ func (im *ControllerMetrics) computeIngressMetrics() (map[feature]int, map[featu
 	im.Lock()
 	defer im.Unlock()
 
+	// Static ip conflicts are computed across ingresses rather than from a
+	// single ingress state.
+	staticIPFanout := im.staticIPFanout()
 	for ingKey, ingState := range im.ingressMap {
 		// Both frontend and backend associated ingress features are tracked.
 		currIngFeatures := make(map[feature]bool)
@@ -215,23 +500,814 @@ func (im *ControllerMetrics) computeIngressMetrics() (map[feature]int, map[featu
 			// Update service port feature counts.
 			updateServicePortCount(svcPortCount, svcFeatures)
 		}
+		if staticIPFanout[ingState.ingress.Annotations[staticIPKey]] > 1 {
+			klog.V(6).Infof("Static ip of ingress %s is shared with another ingress", ingKey)
+			currIngFeatures[staticIPConflict] = true
+		}
+		// Add features that are computed by correlating frontend and backend features.
+		addCorrelationFeatures(currIngFeatures, ingState)
 		klog.V(6).Infof("Features for ingress %s: %v", ingKey, currIngFeatures)
 		// Merge current ingress to update ingress feature counts.
 		updateIngressCount(ingCount, currIngFeatures)
 	}
+	im.recordFeatureHistory(ingCount)
 
 	klog.V(4).Infof("Ingress usage metrics computed.")
 	return ingCount, svcPortCount
 }
 
+// computeIngressMetricsFiltered computes per-feature ingress counts restricted
+// to the ingresses whose key matches the given predicate.
+func (im *ControllerMetrics) computeIngressMetricsFiltered(predicate func(ingKey string) bool) map[feature]int {
+	ingCount, _ := initializeCounts()
+	im.Lock()
+	defer im.Unlock()
+
+	for ingKey, ingState := range im.ingressMap {
+		if !predicate(ingKey) {
+			klog.V(6).Infof("Ingress %s does not match the predicate, skipping", ingKey)
+			continue
+		}
+		updateIngressCount(ingCount, featuresForIngressState(ingState))
+	}
+	return ingCount
+}
+
+// computeIngressMetricsExcluding computes per-feature ingress counts over all
+// tracked ingresses except the given keys, e.g. the un-migrated set during a
+// phased rollout.
+func (im *ControllerMetrics) computeIngressMetricsExcluding(keys map[string]bool) map[feature]int {
+	ingCount, _ := initializeCounts()
+	im.Lock()
+	defer im.Unlock()
+
+	for ingKey, ingState := range im.ingressMap {
+		if keys[ingKey] {
+			klog.V(6).Infof("Ingress %s is excluded, skipping", ingKey)
+			continue
+		}
+		updateIngressCount(ingCount, featuresForIngressState(ingState))
+	}
+	return ingCount
+}
+
+// computeIngressMetricsWhere computes per-feature ingress counts restricted
+// to the ingresses that also have the given feature, answering questions like
+// "of the ingresses with TLS termination, how many use Cloud Armor?".
+func (im *ControllerMetrics) computeIngressMetricsWhere(has feature) map[feature]int {
+	ingCount, _ := initializeCounts()
+	im.Lock()
+	defer im.Unlock()
+
+	for ingKey, ingState := range im.ingressMap {
+		ingFeatures := featuresForIngressState(ingState)
+		if !ingFeatures[has] {
+			klog.V(6).Infof("Ingress %s does not have feature %s, skipping", ingKey, has)
+			continue
+		}
+		updateIngressCount(ingCount, ingFeatures)
+	}
+	return ingCount
+}
+
+// computeIngressMetricsGroupedBy computes per-feature ingress counts grouped
+// by the label returned by the given function for each tracked ingress.
+func (im *ControllerMetrics) computeIngressMetricsGroupedBy(labelFn func(ing *v1beta1.Ingress) string) map[string]map[feature]int {
+	im.Lock()
+	defer im.Unlock()
+
+	grouped := make(map[string]map[feature]int)
+	for ingKey, ingState := range im.ingressMap {
+		group := labelFn(ingState.ingress)
+		ingCount, ok := grouped[group]
+		if !ok {
+			ingCount, _ = initializeCounts()
+			grouped[group] = ingCount
+		}
+		klog.V(6).Infof("Ingress %s is grouped under %q", ingKey, group)
+		updateIngressCount(ingCount, featuresForIngressState(ingState))
+	}
+	return grouped
+}
+
+// computeInternalIngressMetrics computes per-feature ingress counts restricted
+// to L7 ILB ingresses.
+func (im *ControllerMetrics) computeInternalIngressMetrics() map[feature]int {
+	ingCount, _ := initializeCounts()
+	im.Lock()
+	defer im.Unlock()
+
+	for ingKey, ingState := range im.ingressMap {
+		features := featuresForIngressState(ingState)
+		if !features[internalIngress] {
+			klog.V(6).Infof("Ingress %s is not an internal ingress, skipping", ingKey)
+			continue
+		}
+		updateIngressCount(ingCount, features)
+	}
+	return ingCount
+}
+
+// computeCloudArmorCoverage returns, for each tracked ingress with service
+// ports, the fraction of its service ports that attach a Cloud Armor security
+// policy.
+func (im *ControllerMetrics) computeCloudArmorCoverage() map[string]float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	coverage := make(map[string]float64)
+	for ingKey, ingState := range im.ingressMap {
+		if len(ingState.servicePorts) == 0 {
+			continue
+		}
+		armoredPorts := 0
+		for _, svcPort := range ingState.servicePorts {
+			if svcPort.BackendConfig != nil && svcPort.BackendConfig.Spec.SecurityPolicy != nil {
+				armoredPorts++
+			}
+		}
+		klog.V(6).Infof("Ingress %s has %d armored ports out of %d", ingKey, armoredPorts, len(ingState.servicePorts))
+		coverage[ingKey] = float64(armoredPorts) / float64(len(ingState.servicePorts))
+	}
+	return coverage
+}
+
+// computeIapAndArmorBackends returns the number of tracked service ports that
+// enable both Cloud IAP and a Cloud Armor security policy. Service ports
+// shared by multiple ingresses are counted once.
+func (im *ControllerMetrics) computeIapAndArmorBackends() int {
+	im.Lock()
+	defer im.Unlock()
+
+	svcPorts := make(map[servicePortKey]bool)
+	iapAndArmorPorts := 0
+	for _, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			svcPortKey := newServicePortKey(svcPort)
+			if svcPorts[svcPortKey] {
+				continue
+			}
+			svcPorts[svcPortKey] = true
+			features := make(map[feature]bool)
+			for _, ftr := range featuresForServicePort(svcPort) {
+				features[ftr] = true
+			}
+			if features[cloudIAP] && features[cloudArmor] {
+				klog.V(6).Infof("Both Cloud IAP and Cloud Armor are enabled for service port %s", svcPortKey.string())
+				iapAndArmorPorts++
+			}
+		}
+	}
+	return iapAndArmorPorts
+}
+
+// computeUniqueBackendServices returns the number of distinct backend service
+// identities referenced by the service ports of all tracked ingresses.
+func (im *ControllerMetrics) computeUniqueBackendServices() int {
+	im.Lock()
+	defer im.Unlock()
+
+	uniqueServices := make(map[types.NamespacedName]bool)
+	for ingKey, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			uniqueServices[svcPort.ID.Service] = true
+		}
+		klog.V(6).Infof("Counted backend services of ingress %s", ingKey)
+	}
+	return len(uniqueServices)
+}
+
+// computeBackendsWithoutConfig returns the number of tracked service ports
+// without a BackendConfig and the complement count with one. Service ports
+// shared by multiple ingresses are counted once.
+func (im *ControllerMetrics) computeBackendsWithoutConfig() (int, int) {
+	im.Lock()
+	defer im.Unlock()
+
+	svcPorts := make(map[servicePortKey]bool)
+	withoutConfig, withConfig := 0, 0
+	for _, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			svcPortKey := newServicePortKey(svcPort)
+			if svcPorts[svcPortKey] {
+				continue
+			}
+			svcPorts[svcPortKey] = true
+			if svcPort.BackendConfig == nil {
+				klog.V(6).Infof("No backend config is specified for service port %s", svcPortKey.string())
+				withoutConfig++
+			} else {
+				withConfig++
+			}
+		}
+	}
+	return withoutConfig, withConfig
+}
+
+// computeImpliedBackendServices returns the number of distinct (service,
+// port) pairs across the service ports of all tracked ingresses, approximating
+// the number of GCE backend services the controller creates for them. Shared
+// backends are counted once.
+func (im *ControllerMetrics) computeImpliedBackendServices() int {
+	im.Lock()
+	defer im.Unlock()
+
+	backendServices := make(map[utils.ServicePortID]bool)
+	for ingKey, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			backendServices[svcPort.ID] = true
+		}
+		klog.V(6).Infof("Counted implied backend services of ingress %s", ingKey)
+	}
+	return len(backendServices)
+}
+
+// computeServicePortProtocolCounts returns the number of tracked service
+// ports for each backend protocol. Service ports without an application
+// protocol resolve to HTTP. Service ports shared by multiple ingresses are
+// counted once.
+func (im *ControllerMetrics) computeServicePortProtocolCounts() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	svcPorts := make(map[servicePortKey]bool)
+	protocolCounts := make(map[string]int)
+	for _, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			svcPortKey := newServicePortKey(svcPort)
+			if svcPorts[svcPortKey] {
+				continue
+			}
+			svcPorts[svcPortKey] = true
+			protocol := svcPort.Protocol
+			if protocol == "" {
+				protocol = annotations.ProtocolHTTP
+			}
+			klog.V(6).Infof("Service port %s resolves to protocol %s", svcPortKey.string(), protocol)
+			protocolCounts[string(protocol)]++
+		}
+	}
+	return protocolCounts
+}
+
+// computeAverageBackendsPerIngress returns the mean number of service ports
+// across all tracked ingresses, or 0 when no ingresses are tracked.
+func (im *ControllerMetrics) computeAverageBackendsPerIngress() float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	if len(im.ingressMap) == 0 {
+		return 0
+	}
+	totalBackends := 0
+	for ingKey, ingState := range im.ingressMap {
+		totalBackends += len(ingState.servicePorts)
+		klog.V(6).Infof("Counted %d backends of ingress %s", len(ingState.servicePorts), ingKey)
+	}
+	return float64(totalBackends) / float64(len(im.ingressMap))
+}
+
+// computeIngressesWithNoBackends returns the number of tracked ingresses
+// whose spec references at least one backend while no service port resolved,
+// as opposed to ingresses with a truly empty spec.
+func (im *ControllerMetrics) computeIngressesWithNoBackends() int {
+	im.Lock()
+	defer im.Unlock()
+
+	noBackendIngresses := 0
+	for ingKey, ingState := range im.ingressMap {
+		if len(ingState.servicePorts) > 0 || !specReferencesBackend(ingState.ingress) {
+			continue
+		}
+		klog.V(6).Infof("No service port resolved for ingress %s with spec backends", ingKey)
+		noBackendIngresses++
+	}
+	return noBackendIngresses
+}
+
+// specReferencesBackend returns true if the spec of the given ingress
+// references a default backend or a rule path backend.
+func specReferencesBackend(ing *v1beta1.Ingress) bool {
+	if ing.Spec.Backend != nil {
+		return true
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// computeSharedBackendGroups returns, for each (service, port) pair that is
+// referenced by more than one tracked ingress, the keys of the ingresses
+// sharing the implied GCE backend service, sorted by name.
+func (im *ControllerMetrics) computeSharedBackendGroups() map[string][]string {
+	im.Lock()
+	defer im.Unlock()
+
+	ingKeys := make(map[utils.ServicePortID]map[string]bool)
+	for ingKey, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			if ingKeys[svcPort.ID] == nil {
+				ingKeys[svcPort.ID] = make(map[string]bool)
+			}
+			ingKeys[svcPort.ID][ingKey] = true
+		}
+	}
+	groups := make(map[string][]string)
+	for svcPortID, keys := range ingKeys {
+		if len(keys) < 2 {
+			continue
+		}
+		group := make([]string, 0, len(keys))
+		for ingKey := range keys {
+			group = append(group, ingKey)
+		}
+		sort.Strings(group)
+		klog.V(6).Infof("Backend service for %s is shared by ingresses %v", svcPortID, group)
+		groups[svcPortID.String()] = group
+	}
+	return groups
+}
+
+// computePreSharedCertFanout returns, for each pre-shared certificate name,
+// the number of tracked ingresses that reference it.
+func (im *ControllerMetrics) computePreSharedCertFanout() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	fanout := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		val, ok := ingState.ingress.Annotations[preSharedCertKey]
+		if !ok {
+			continue
+		}
+		klog.V(6).Infof("Pre-shared certs for ingress %s: %s", ingKey, val)
+		// Count a certificate at most once per ingress.
+		seen := make(map[string]bool)
+		for _, cert := range parseCertList(val) {
+			if seen[cert] {
+				continue
+			}
+			seen[cert] = true
+			fanout[cert]++
+		}
+	}
+	return fanout
+}
+
+// computeStaticIPFanout returns, for each static ip annotation value, the
+// number of tracked ingresses that reference it.
+func (im *ControllerMetrics) computeStaticIPFanout() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	return im.staticIPFanout()
+}
+
+// staticIPFanout computes the static ip fanout across all tracked ingresses.
+// Callers must hold im.Lock.
+func (im *ControllerMetrics) staticIPFanout() map[string]int {
+	fanout := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		val, ok := ingState.ingress.Annotations[staticIPKey]
+		if !ok || val == "" {
+			continue
+		}
+		klog.V(6).Infof("Static ip for ingress %s: %s", ingKey, val)
+		fanout[val]++
+	}
+	return fanout
+}
+
+// computeStaticIPConflicts returns the number of tracked ingresses reporting
+// the staticIPConflict feature, that is ingresses whose static ip is also
+// referenced by another tracked ingress.
+func (im *ControllerMetrics) computeStaticIPConflicts() int {
+	conflicts := 0
+	for ip, count := range im.computeStaticIPFanout() {
+		if count > 1 {
+			klog.V(6).Infof("Static ip %s is referenced by %d ingresses", ip, count)
+			conflicts += count
+		}
+	}
+	return conflicts
+}
+
+// computeIngressesByApiVersion returns the number of tracked ingresses for
+// each networking API version they were read from. Untagged ingress states
+// count as "v1beta1".
+func (im *ControllerMetrics) computeIngressesByApiVersion() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	versionCounts := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		version := ingState.apiVersion
+		if version == "" {
+			version = "v1beta1"
+		}
+		klog.V(6).Infof("Ingress %s was read from API version %s", ingKey, version)
+		versionCounts[version]++
+	}
+	return versionCounts
+}
+
+// computeSecurityPolicyFanout returns, for each Cloud Armor security policy
+// name, the number of tracked ingresses with a service port that references
+// it.
+func (im *ControllerMetrics) computeSecurityPolicyFanout() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	fanout := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		// Count a policy at most once per ingress.
+		seen := make(map[string]bool)
+		for _, svcPort := range ingState.servicePorts {
+			if svcPort.BackendConfig == nil || svcPort.BackendConfig.Spec.SecurityPolicy == nil {
+				continue
+			}
+			policy := svcPort.BackendConfig.Spec.SecurityPolicy.Name
+			if policy == "" || seen[policy] {
+				continue
+			}
+			klog.V(6).Infof("Security policy for a service port of ingress %s: %s", ingKey, policy)
+			seen[policy] = true
+			fanout[policy]++
+		}
+	}
+	return fanout
+}
+
+// computeUniformBackendConfigIngresses returns the number of tracked
+// ingresses whose service ports with a BackendConfig all reference the same
+// config. Ingresses without any configured service port are not counted.
+func (im *ControllerMetrics) computeUniformBackendConfigIngresses() int {
+	im.Lock()
+	defer im.Unlock()
+
+	uniformIngresses := 0
+	for ingKey, ingState := range im.ingressMap {
+		configKeys := make(map[string]bool)
+		for _, svcPort := range ingState.servicePorts {
+			if svcPort.BackendConfig == nil {
+				continue
+			}
+			configKey := fmt.Sprintf("%s/%s", svcPort.BackendConfig.Namespace, svcPort.BackendConfig.Name)
+			configKeys[configKey] = true
+		}
+		if len(configKeys) == 1 {
+			klog.V(6).Infof("All configured service ports of ingress %s use the same BackendConfig", ingKey)
+			uniformIngresses++
+		}
+	}
+	return uniformIngresses
+}
+
+// FeatureSimilarity returns the Jaccard similarity of the combined feature
+// sets of the two given ingresses, i.e. the size of the intersection divided
+// by the size of the union. Returns an error if either key is not tracked.
+func (im *ControllerMetrics) FeatureSimilarity(keyA, keyB string) (float64, error) {
+	im.Lock()
+	defer im.Unlock()
+
+	stateA, ok := im.ingressMap[keyA]
+	if !ok {
+		return 0, fmt.Errorf("ingress %s is not tracked", keyA)
+	}
+	stateB, ok := im.ingressMap[keyB]
+	if !ok {
+		return 0, fmt.Errorf("ingress %s is not tracked", keyB)
+	}
+	featuresA := featuresForIngressState(stateA)
+	featuresB := featuresForIngressState(stateB)
+	intersection := 0
+	for ftr := range featuresA {
+		if featuresB[ftr] {
+			intersection++
+		}
+	}
+	union := len(featuresA) + len(featuresB) - intersection
+	if union == 0 {
+		return 0, nil
+	}
+	similarity := float64(intersection) / float64(union)
+	klog.V(6).Infof("Feature similarity of ingresses %s and %s: %v", keyA, keyB, similarity)
+	return similarity, nil
+}
+
+// FeatureGaps returns the features that are present on other tracked
+// ingresses in the same namespace but absent from the given ingress. Returns
+// nil if the ingress is not tracked. This helps consistency audits find the
+// one ingress in a namespace that forgot to enable a feature.
+func (im *ControllerMetrics) FeatureGaps(ingKey string) []feature {
+	im.Lock()
+	defer im.Unlock()
+
+	ingState, ok := im.ingressMap[ingKey]
+	if !ok {
+		klog.V(4).Infof("Ingress %s is not tracked, no feature gaps computed", ingKey)
+		return nil
+	}
+	ownFeatures := featuresForIngressState(ingState)
+	gaps := make(map[feature]bool)
+	for key, otherState := range im.ingressMap {
+		if key == ingKey || otherState.ingress.Namespace != ingState.ingress.Namespace {
+			continue
+		}
+		for ftr := range featuresForIngressState(otherState) {
+			if !ownFeatures[ftr] {
+				gaps[ftr] = true
+			}
+		}
+	}
+	var features []feature
+	for ftr := range gaps {
+		features = append(features, ftr)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+	return features
+}
+
+// urlMapPathMatcherLimit is the maximum number of path matchers allowed in a
+// GCE URL map. Each distinct rule host needs one path matcher.
+const urlMapPathMatcherLimit = 50
+
+// computePathMatcherCountHistogram buckets, for each tracked ingress, the
+// number of GCE URL map path matchers it would need. Each distinct rule host
+// maps to a path matcher plus one for the default backend. This helps predict
+// ingresses approaching the URL map size limits.
+func (im *ControllerMetrics) computePathMatcherCountHistogram() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	histogram := map[string]int{
+		"1":     0,
+		"2-10":  0,
+		"11-50": 0,
+		"51+":   0,
+	}
+	for ingKey, ingState := range im.ingressMap {
+		hosts := make(map[string]bool)
+		for _, rule := range ingState.ingress.Spec.Rules {
+			if rule.Host != "" {
+				hosts[rule.Host] = true
+			}
+		}
+		pathMatcherCount := len(hosts) + 1
+		klog.V(6).Infof("Ingress %s needs %d path matchers", ingKey, pathMatcherCount)
+		switch {
+		case pathMatcherCount <= 1:
+			histogram["1"]++
+		case pathMatcherCount <= 10:
+			histogram["2-10"]++
+		case pathMatcherCount <= urlMapPathMatcherLimit:
+			histogram["11-50"]++
+		default:
+			histogram["51+"]++
+		}
+	}
+	return histogram
+}
+
+// computeAnnotationCountHistogram buckets, for each tracked ingress, the
+// number of annotations on its object. Heavily-annotated ingresses are harder
+// to maintain.
+func (im *ControllerMetrics) computeAnnotationCountHistogram() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	histogram := map[string]int{
+		"0-2":  0,
+		"3-5":  0,
+		"6-10": 0,
+		"11+":  0,
+	}
+	for ingKey, ingState := range im.ingressMap {
+		annotationCount := len(ingState.ingress.Annotations)
+		klog.V(6).Infof("Ingress %s has %d annotations", ingKey, annotationCount)
+		switch {
+		case annotationCount <= 2:
+			histogram["0-2"]++
+		case annotationCount <= 5:
+			histogram["3-5"]++
+		case annotationCount <= 10:
+			histogram["6-10"]++
+		default:
+			histogram["11+"]++
+		}
+	}
+	return histogram
+}
+
+// computeSingleHostIngresses returns the number of tracked ingresses whose
+// rules specify exactly one distinct host. Rules without a host match any
+// host and are not counted as a distinct host.
+func (im *ControllerMetrics) computeSingleHostIngresses() int {
+	im.Lock()
+	defer im.Unlock()
+
+	singleHostIngresses := 0
+	for ingKey, ingState := range im.ingressMap {
+		hosts := make(map[string]bool)
+		for _, rule := range ingState.ingress.Spec.Rules {
+			if rule.Host != "" {
+				hosts[rule.Host] = true
+			}
+		}
+		if len(hosts) == 1 {
+			klog.V(6).Infof("Ingress %s serves a single host", ingKey)
+			singleHostIngresses++
+		}
+	}
+	return singleHostIngresses
+}
+
+// computeDistinctHosts returns the number of unique rule hosts across all
+// tracked ingresses, deduplicated across ingresses. This helps with DNS and
+// certificate planning.
+func (im *ControllerMetrics) computeDistinctHosts() int {
+	im.Lock()
+	defer im.Unlock()
+
+	hosts := make(map[string]bool)
+	for ingKey, ingState := range im.ingressMap {
+		for _, rule := range ingState.ingress.Spec.Rules {
+			if rule.Host != "" {
+				hosts[rule.Host] = true
+			}
+		}
+		klog.V(6).Infof("Counted rule hosts of ingress %s", ingKey)
+	}
+	return len(hosts)
+}
+
+// computeManagedCertCountHistogram buckets, for each tracked ingress, the
+// number of google managed certificate names it lists in the managed
+// certificates annotation.
+func (im *ControllerMetrics) computeManagedCertCountHistogram() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	histogram := map[string]int{
+		"0":   0,
+		"1":   0,
+		"2-5": 0,
+		"6+":  0,
+	}
+	for ingKey, ingState := range im.ingressMap {
+		certCount := len(parseCertList(ingState.ingress.Annotations[managedCertKey]))
+		klog.V(6).Infof("Ingress %s lists %d managed certs", ingKey, certCount)
+		switch {
+		case certCount == 0:
+			histogram["0"]++
+		case certCount == 1:
+			histogram["1"]++
+		case certCount <= 5:
+			histogram["2-5"]++
+		default:
+			histogram["6+"]++
+		}
+	}
+	return histogram
+}
+
+// computeFrontendConfigFanout returns, for each FrontendConfig name, the
+// number of tracked ingresses that reference it. A FrontendConfig shared
+// across many ingresses couples them like a shared pre-shared cert does.
+func (im *ControllerMetrics) computeFrontendConfigFanout() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	fanout := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		val, ok := ingState.ingress.Annotations[frontendConfigKey]
+		if !ok || val == "" {
+			continue
+		}
+		klog.V(6).Infof("FrontendConfig for ingress %s: %s", ingKey, val)
+		fanout[val]++
+	}
+	return fanout
+}
+
+// computeRedirectResponseCodeCounts returns, for each https redirect response
+// code name, the number of tracked ingresses whose frontend config redirects
+// with it. Redirecting ingresses without an explicit response code count as
+// MOVED_PERMANENTLY_DEFAULT.
+func (im *ControllerMetrics) computeRedirectResponseCodeCounts() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	responseCodeCounts := make(map[string]int)
+	for ingKey, ingState := range im.ingressMap {
+		feConfig := ingState.frontendconfig
+		if feConfig == nil || feConfig.Spec.RedirectToHttps == nil || !feConfig.Spec.RedirectToHttps.Enabled {
+			continue
+		}
+		responseCode := feConfig.Spec.RedirectToHttps.ResponseCodeName
+		if responseCode == "" {
+			responseCode = "MOVED_PERMANENTLY_DEFAULT"
+		}
+		klog.V(6).Infof("Https redirect response code for ingress %s: %s", ingKey, responseCode)
+		responseCodeCounts[responseCode]++
+	}
+	return responseCodeCounts
+}
+
+// riskFeatures are the likely-misconfiguration features that are surfaced as
+// a single flag count in HealthSummary.
+var riskFeatures = []feature{iapWithoutTLS, redirectWithoutHTTP, conflictingManagedCertScope, negPortMismatch, h2cBackend}
+
+// RiskFeatures returns the risk features flagged on the given ingress, in
+// riskFeatures order. Returns nil if the ingress is not tracked or carries no
+// risk features.
+func (im *ControllerMetrics) RiskFeatures(ingKey string) []feature {
+	im.Lock()
+	defer im.Unlock()
+
+	ingState, ok := im.ingressMap[ingKey]
+	if !ok {
+		klog.V(4).Infof("Ingress %s is not tracked, no risk features computed", ingKey)
+		return nil
+	}
+	ingFeatures := featuresForIngressState(ingState)
+	var flagged []feature
+	for _, ftr := range riskFeatures {
+		if ingFeatures[ftr] {
+			flagged = append(flagged, ftr)
+		}
+	}
+	return flagged
+}
+
+// HealthSummary is a one-glance aggregate of the tracked cluster state.
+type HealthSummary struct {
+	// Ingresses is the total number of tracked ingresses.
+	Ingresses int
+	// ServicePorts is the total number of tracked service ports.
+	ServicePorts int
+	// Negs is the total number of tracked NEGs.
+	Negs int
+	// RiskFlags is the total count of risk features across all ingresses.
+	RiskFlags int
+}
+
+// HealthSummary aggregates the computed feature counts into totals and a
+// single count of flagged risk features.
+func (im *ControllerMetrics) HealthSummary() HealthSummary {
+	ingCount, svcPortCount := im.computeIngressMetrics()
+	negCount := im.computeNegMetrics()
+	summary := HealthSummary{
+		Ingresses:    ingCount[ingress],
+		ServicePorts: svcPortCount[servicePort],
+		Negs:         negCount[neg],
+	}
+	for _, ftr := range riskFeatures {
+		summary.RiskFlags += ingCount[ftr]
+	}
+	return summary
+}
+
+// FeatureCount pairs a feature name with its computed count.
+type FeatureCount struct {
+	Feature string
+	Count   int
+}
+
+// TopFeatures returns the n most used features across the combined ingress
+// and service port feature counts, sorted by descending count with ties
+// broken by feature name.
+func (im *ControllerMetrics) TopFeatures(n int) []FeatureCount {
+	ingCount, svcPortCount := im.computeIngressMetrics()
+	combined := make(map[feature]int, len(ingCount))
+	for ftr, count := range ingCount {
+		combined[ftr] += count
+	}
+	for ftr, count := range svcPortCount {
+		combined[ftr] += count
+	}
+	top := make([]FeatureCount, 0, len(combined))
+	for ftr, count := range combined {
+		top = append(top, FeatureCount{Feature: ftr.String(), Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Feature < top[j].Feature
+	})
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
 // computeNegMetrics aggregates NEG metrics in the cache
 func (im *ControllerMetrics) computeNegMetrics() map[feature]int {
-	counts := map[feature]int{
-		standaloneNeg: 0,
-		ingressNeg:    0,
-		asmNeg:        0,
-		neg:           0,
-	}
+	counts := negFeatureCounts()
 
 	for key, negState := range im.negMap {
 		klog.V(6).Infof("For service %s, it has standaloneNegs:%v, ingressNegs:%v and asmNeg:%v", key, negState.StandaloneNeg, negState.IngressNeg, negState.AsmNeg)
@@ -239,35 +1315,224 @@ func (im *ControllerMetrics) computeNegMetrics() map[feature]int {
 		counts[ingressNeg] += negState.IngressNeg
 		counts[asmNeg] += negState.AsmNeg
 		counts[neg] += negState.AsmNeg + negState.StandaloneNeg + negState.IngressNeg
+		if negState.ReadinessGateEnabled {
+			counts[negReadinessGate]++
+		}
+		if negState.SubsettingEnabled {
+			counts[asmNegSubsetting]++
+		}
 	}
 	return counts
 }
 
+// computeStandaloneNegFraction returns the fraction of tracked NEGs that are
+// standalone, or 0 when no NEGs are tracked.
+func (im *ControllerMetrics) computeStandaloneNegFraction() float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	standaloneNegs, totalNegs := 0, 0
+	for key, negState := range im.negMap {
+		klog.V(6).Infof("Service %s has %d standalone NEGs", key, negState.StandaloneNeg)
+		standaloneNegs += negState.StandaloneNeg
+		totalNegs += negState.StandaloneNeg + negState.IngressNeg + negState.AsmNeg
+	}
+	if totalNegs == 0 {
+		return 0
+	}
+	return float64(standaloneNegs) / float64(totalNegs)
+}
+
+// computeIngressNegRatio returns the number of ingress created NEGs per
+// tracked ingress, or 0 when no ingresses are tracked. A high ratio
+// highlights NEG fan-out.
+func (im *ControllerMetrics) computeIngressNegRatio() float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	if len(im.ingressMap) == 0 {
+		return 0
+	}
+	ingressNegs := 0
+	for key, negState := range im.negMap {
+		klog.V(6).Infof("Service %s has %d ingress NEGs", key, negState.IngressNeg)
+		ingressNegs += negState.IngressNeg
+	}
+	return float64(ingressNegs) / float64(len(im.ingressMap))
+}
+
+// computeAsmAndIngressNegServices returns the number of tracked services that
+// have both ASM managed and ingress backed NEGs at the same time.
+func (im *ControllerMetrics) computeAsmAndIngressNegServices() int {
+	im.Lock()
+	defer im.Unlock()
+
+	asmAndIngressServices := 0
+	for key, negState := range im.negMap {
+		if negState.AsmNeg > 0 && negState.IngressNeg > 0 {
+			klog.V(6).Infof("Service %s has both ASM and ingress NEGs", key)
+			asmAndIngressServices++
+		}
+	}
+	return asmAndIngressServices
+}
+
+// computeNegReadinessGateServices returns the number of tracked NEG services
+// whose backing pods use the NEG readiness gate.
+func (im *ControllerMetrics) computeNegReadinessGateServices() int {
+	im.Lock()
+	defer im.Unlock()
+
+	readinessGateServices := 0
+	for key, negState := range im.negMap {
+		if negState.ReadinessGateEnabled {
+			klog.V(6).Infof("Readiness gate is enabled for the NEGs of service %s", key)
+			readinessGateServices++
+		}
+	}
+	return readinessGateServices
+}
+
+// computeNegEndpointHistogram returns the number of NEG services in each
+// endpoint count bucket.
+func (im *ControllerMetrics) computeNegEndpointHistogram() map[string]int {
+	im.Lock()
+	defer im.Unlock()
+
+	histogram := map[string]int{
+		"0":      0,
+		"1-10":   0,
+		"11-100": 0,
+		"100+":   0,
+	}
+	for key, negState := range im.negMap {
+		klog.V(6).Infof("Service %s has %d NEG endpoints", key, negState.EndpointCount)
+		switch {
+		case negState.EndpointCount <= 0:
+			histogram["0"]++
+		case negState.EndpointCount <= 10:
+			histogram["1-10"]++
+		case negState.EndpointCount <= 100:
+			histogram["11-100"]++
+		default:
+			histogram["100+"]++
+		}
+	}
+	return histogram
+}
+
+// computeNegAdoptionRatio returns the fraction of tracked service ports that
+// are NEG-backed. Service ports shared by multiple ingresses are counted once.
+// Returns 0 if no service ports are tracked.
+func (im *ControllerMetrics) computeNegAdoptionRatio() float64 {
+	im.Lock()
+	defer im.Unlock()
+
+	svcPorts := make(map[servicePortKey]bool)
+	negPorts := 0
+	for _, ingState := range im.ingressMap {
+		for _, svcPort := range ingState.servicePorts {
+			svcPortKey := newServicePortKey(svcPort)
+			if svcPorts[svcPortKey] {
+				continue
+			}
+			svcPorts[svcPortKey] = true
+			if svcPort.NEGEnabled {
+				negPorts++
+			}
+		}
+	}
+	if len(svcPorts) == 0 {
+		return 0
+	}
+	return float64(negPorts) / float64(len(svcPorts))
+}
+
+// negFeatureCounts initializes the feature count map for NEGs.
+func negFeatureCounts() map[feature]int {
+	return map[feature]int{
+		standaloneNeg:    0,
+		ingressNeg:       0,
+		asmNeg:           0,
+		neg:              0,
+		negReadinessGate: 0,
+		asmNegSubsetting: 0,
+	}
+}
+
 // initializeCounts initializes feature count maps for ingress and service ports.
 // This is required in order to reset counts for features that do not exist now
 // but existed before.
 func initializeCounts() (map[feature]int, map[feature]int) {
 	return map[feature]int{
-			ingress:                   0,
-			externalIngress:           0,
-			internalIngress:           0,
-			httpEnabled:               0,
-			hostBasedRouting:          0,
-			pathBasedRouting:          0,
-			tlsTermination:            0,
-			secretBasedCertsForTLS:    0,
-			preSharedCertsForTLS:      0,
-			managedCertsForTLS:        0,
-			staticGlobalIP:            0,
-			neg:                       0,
-			cloudCDN:                  0,
-			cloudArmor:                0,
-			cloudIAP:                  0,
-			backendTimeout:            0,
-			backendConnectionDraining: 0,
-			clientIPAffinity:          0,
-			cookieAffinity:            0,
-			customRequestHeaders:      0,
+			ingress:                     0,
+			externalIngress:             0,
+			internalIngress:             0,
+			ilbGlobalAccess:             0,
+			conflictingIngressClass:     0,
+			alphaIngressClass:           0,
+			httpEnabled:                 0,
+			hostBasedRouting:            0,
+			hostNameTooLong:             0,
+			pathBasedRouting:            0,
+			hostlessPathRules:           0,
+			namedServicePort:            0,
+			numberedServicePort:         0,
+			emptyExplicitRules:          0,
+			crossNamespaceBackend:       0,
+			certExpiringSoon:            0,
+			tlsHostCertMismatch:         0,
+			certNameCollision:           0,
+			weakTLSPolicy:               0,
+			customDefaultBackend:        0,
+			ingressTimeout:              0,
+			tlsTermination:              0,
+			dualProtocol:                0,
+			secretBasedCertsForTLS:      0,
+			crossNamespaceSecret:        0,
+			preSharedCertsForTLS:        0,
+			duplicatePreSharedCerts:     0,
+			managedCertsForTLS:          0,
+			wildcardManagedCert:         0,
+			managedCertLimitRisk:        0,
+			regionalManagedCertsForTLS:  0,
+			conflictingManagedCertScope: 0,
+			externalCertMap:             0,
+			staticGlobalIP:              0,
+			malformedStaticIP:           0,
+			staticIPWithoutTLS:          0,
+			staticIPConflict:            0,
+			iapWithoutTLS:               0,
+			redirectWithoutHTTP:         0,
+			redirectingHTTP:             0,
+			trafficSplitting:            0,
+			neg:                         0,
+			h2cBackend:                  0,
+			httpsBackend:                0,
+			negDefaultHealthCheck:       0,
+			negPortMismatch:             0,
+			negCustomPortName:           0,
+			capacityOverride:            0,
+			cloudCDN:                    0,
+			cdnBypassHeaders:            0,
+			cdnServeWhileStale:          0,
+			cdnWithIap:                  0,
+			cloudArmor:                  0,
+			cloudIAP:                    0,
+			iapOpenAccess:               0,
+			backendTimeout:              0,
+			backendConnectionDraining:   0,
+			drainingDisabled:            0,
+			drainingTimeoutClamped:      0,
+			inconsistentDrainTimeout:    0,
+			clientIPAffinity:            0,
+			cookieAffinity:              0,
+			generatedCookieAffinity:     0,
+			explicitNoAffinity:          0,
+			igAffinity:                  0,
+			customRequestHeaders:        0,
+			templatedRequestHeaders:     0,
+			clientCertHeaders:           0,
 		},
 		// service port counts
 		map[feature]int{
@@ -275,14 +1540,32 @@ func initializeCounts() (map[feature]int, map[feature]int) {
 			externalServicePort:       0,
 			internalServicePort:       0,
 			neg:                       0,
+			h2cBackend:                0,
+			httpsBackend:              0,
+			negDefaultHealthCheck:     0,
+			negPortMismatch:           0,
+			negCustomPortName:         0,
+			capacityOverride:          0,
 			cloudCDN:                  0,
+			cdnBypassHeaders:          0,
+			cdnServeWhileStale:        0,
+			cdnWithIap:                0,
 			cloudArmor:                0,
 			cloudIAP:                  0,
+			iapOpenAccess:             0,
 			backendTimeout:            0,
 			backendConnectionDraining: 0,
+			drainingDisabled:          0,
+			drainingTimeoutClamped:    0,
+			inconsistentDrainTimeout:  0,
 			clientIPAffinity:          0,
 			cookieAffinity:            0,
+			generatedCookieAffinity:   0,
+			explicitNoAffinity:        0,
+			igAffinity:                0,
 			customRequestHeaders:      0,
+			templatedRequestHeaders:   0,
+			clientCertHeaders:         0,
 		}
 }
 
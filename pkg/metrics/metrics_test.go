@@ -18,14 +18,19 @@ package metrics
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigv1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/utils"
 	"reflect"
 )
@@ -172,10 +177,10 @@ var (
 					Rules: []v1beta1.IngressRule{},
 				},
 			},
-			[]feature{ingress, externalIngress, httpEnabled},
+			[]feature{ingress, externalIngress, httpEnabled, emptyExplicitRules, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[0]},
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining},
 		},
 		{
 			"host rule only",
@@ -225,10 +230,10 @@ var (
 				},
 			},
 			[]feature{ingress, externalIngress, httpEnabled,
-				hostBasedRouting, pathBasedRouting},
+				hostBasedRouting, pathBasedRouting, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[1]},
-			[]feature{servicePort, externalServicePort, neg, cloudIAP,
-				clientIPAffinity, backendTimeout, customRequestHeaders},
+			[]feature{servicePort, externalServicePort, neg, negDefaultHealthCheck,
+				cloudIAP, iapOpenAccess, clientIPAffinity, backendTimeout, customRequestHeaders},
 		},
 		{
 			"default backend and host rule",
@@ -263,11 +268,12 @@ var (
 				},
 			},
 			[]feature{ingress, externalIngress, httpEnabled,
-				hostBasedRouting, pathBasedRouting},
+				hostBasedRouting, pathBasedRouting, numberedServicePort},
 			testServicePorts[:2],
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining, neg, cloudIAP,
-				clientIPAffinity, backendTimeout, customRequestHeaders},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining, neg,
+				negDefaultHealthCheck, cloudIAP, iapOpenAccess, clientIPAffinity, backendTimeout,
+				customRequestHeaders},
 		},
 		{
 			"tls termination with pre-shared certs",
@@ -287,11 +293,11 @@ var (
 					Rules: []v1beta1.IngressRule{},
 				},
 			},
-			[]feature{ingress, externalIngress, httpEnabled,
-				preSharedCertsForTLS, tlsTermination},
+			[]feature{ingress, externalIngress, httpEnabled, emptyExplicitRules,
+				preSharedCertsForTLS, tlsTermination, dualProtocol, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[0]},
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining},
 		},
 		{
 			"tls termination with google managed certs",
@@ -311,11 +317,11 @@ var (
 					Rules: []v1beta1.IngressRule{},
 				},
 			},
-			[]feature{ingress, externalIngress, httpEnabled,
-				managedCertsForTLS, tlsTermination},
+			[]feature{ingress, externalIngress, httpEnabled, emptyExplicitRules,
+				managedCertsForTLS, tlsTermination, dualProtocol, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[0]},
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining},
 		},
 		{
 			"tls termination with pre-shared and google managed certs",
@@ -336,11 +342,11 @@ var (
 					Rules: []v1beta1.IngressRule{},
 				},
 			},
-			[]feature{ingress, externalIngress, httpEnabled,
-				preSharedCertsForTLS, managedCertsForTLS, tlsTermination},
+			[]feature{ingress, externalIngress, httpEnabled, emptyExplicitRules,
+				preSharedCertsForTLS, managedCertsForTLS, tlsTermination, dualProtocol, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[0]},
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining},
 		},
 		{
 			"tls termination with pre-shared and secret based certs",
@@ -380,10 +386,11 @@ var (
 				},
 			},
 			[]feature{ingress, externalIngress, httpEnabled, hostBasedRouting,
-				pathBasedRouting, preSharedCertsForTLS, secretBasedCertsForTLS, tlsTermination},
+				pathBasedRouting, preSharedCertsForTLS, secretBasedCertsForTLS, tlsTermination,
+				dualProtocol, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[1]},
-			[]feature{servicePort, externalServicePort, neg, cloudIAP,
-				clientIPAffinity, backendTimeout, customRequestHeaders},
+			[]feature{servicePort, externalServicePort, neg, negDefaultHealthCheck,
+				cloudIAP, iapOpenAccess, clientIPAffinity, backendTimeout, customRequestHeaders},
 		},
 		{
 			"global static ip",
@@ -404,11 +411,11 @@ var (
 					Rules: []v1beta1.IngressRule{},
 				},
 			},
-			[]feature{ingress, externalIngress, httpEnabled,
-				preSharedCertsForTLS, tlsTermination, staticGlobalIP},
+			[]feature{ingress, externalIngress, httpEnabled, emptyExplicitRules,
+				preSharedCertsForTLS, tlsTermination, dualProtocol, staticGlobalIP, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[0]},
 			[]feature{servicePort, externalServicePort, cloudCDN,
-				cookieAffinity, cloudArmor, backendConnectionDraining},
+				cookieAffinity, generatedCookieAffinity, igAffinity, cloudArmor, backendConnectionDraining},
 		},
 		{
 			"default backend, host rule for internal load-balancer",
@@ -446,10 +453,10 @@ var (
 				},
 			},
 			[]feature{ingress, internalIngress, httpEnabled,
-				hostBasedRouting, pathBasedRouting},
+				hostBasedRouting, pathBasedRouting, numberedServicePort},
 			[]utils.ServicePort{testServicePorts[2], testServicePorts[3]},
-			[]feature{servicePort, internalServicePort, neg, cloudIAP,
-				cookieAffinity, backendConnectionDraining},
+			[]feature{servicePort, internalServicePort, neg, negDefaultHealthCheck,
+				cloudIAP, iapOpenAccess, cookieAffinity, generatedCookieAffinity, backendConnectionDraining},
 		},
 	}
 )
@@ -508,40 +515,106 @@ func TestComputeIngressMetrics(t *testing.T) {
 				NewIngressState(ingressStates[3].ing, ingressStates[3].svcPorts),
 			},
 			map[feature]int{
-				backendConnectionDraining: 0,
-				backendTimeout:            0,
-				clientIPAffinity:          0,
-				cloudArmor:                0,
-				cloudCDN:                  0,
-				cloudIAP:                  0,
-				cookieAffinity:            0,
-				customRequestHeaders:      0,
-				externalIngress:           3,
-				httpEnabled:               2,
-				hostBasedRouting:          1,
-				ingress:                   3,
-				internalIngress:           0,
-				managedCertsForTLS:        0,
-				neg:                       0,
-				pathBasedRouting:          0,
-				preSharedCertsForTLS:      0,
-				secretBasedCertsForTLS:    0,
-				staticGlobalIP:            0,
-				tlsTermination:            0,
+				backendConnectionDraining:   0,
+				drainingDisabled:            0,
+				drainingTimeoutClamped:      0,
+				inconsistentDrainTimeout:    0,
+				backendTimeout:              0,
+				clientIPAffinity:            0,
+				cloudArmor:                  0,
+				cloudCDN:                    0,
+				cdnBypassHeaders:            0,
+				cdnServeWhileStale:          0,
+				cdnWithIap:                  0,
+				cloudIAP:                    0,
+				iapOpenAccess:               0,
+				cookieAffinity:              0,
+				generatedCookieAffinity:     0,
+				explicitNoAffinity:          0,
+				igAffinity:                  0,
+				customRequestHeaders:        0,
+				templatedRequestHeaders:     0,
+				clientCertHeaders:           0,
+				externalIngress:             3,
+				httpEnabled:                 2,
+				hostBasedRouting:            1,
+				hostNameTooLong:             0,
+				emptyExplicitRules:          0,
+				crossNamespaceBackend:       0,
+				certExpiringSoon:            0,
+				tlsHostCertMismatch:         0,
+				certNameCollision:           0,
+				weakTLSPolicy:               0,
+				customDefaultBackend:        0,
+				ingressTimeout:              0,
+				iapWithoutTLS:               0,
+				redirectWithoutHTTP:         0,
+				redirectingHTTP:             0,
+				ingress:                     3,
+				internalIngress:             0,
+				ilbGlobalAccess:             0,
+				conflictingIngressClass:     0,
+				alphaIngressClass:           0,
+				managedCertsForTLS:          0,
+				wildcardManagedCert:         0,
+				managedCertLimitRisk:        0,
+				regionalManagedCertsForTLS:  0,
+				conflictingManagedCertScope: 0,
+				externalCertMap:             0,
+				neg:                         0,
+				h2cBackend:                  0,
+				httpsBackend:                0,
+				negDefaultHealthCheck:       0,
+				negPortMismatch:             0,
+				negCustomPortName:           0,
+				capacityOverride:            0,
+				pathBasedRouting:            0,
+				hostlessPathRules:           0,
+				namedServicePort:            0,
+				numberedServicePort:         0,
+				preSharedCertsForTLS:        0,
+				duplicatePreSharedCerts:     0,
+				secretBasedCertsForTLS:      0,
+				crossNamespaceSecret:        0,
+				staticGlobalIP:              0,
+				malformedStaticIP:           0,
+				staticIPWithoutTLS:          0,
+				staticIPConflict:            0,
+				trafficSplitting:            0,
+				tlsTermination:              0,
+				dualProtocol:                0,
 			},
 			map[feature]int{
 				backendConnectionDraining: 0,
+				drainingDisabled:          0,
+				drainingTimeoutClamped:    0,
+				inconsistentDrainTimeout:  0,
 				backendTimeout:            0,
 				clientIPAffinity:          0,
 				cloudArmor:                0,
 				cloudCDN:                  0,
+				cdnBypassHeaders:          0,
+				cdnServeWhileStale:        0,
+				cdnWithIap:                0,
 				cloudIAP:                  0,
+				iapOpenAccess:             0,
 				cookieAffinity:            0,
+				generatedCookieAffinity:   0,
+				explicitNoAffinity:        0,
+				igAffinity:                0,
 				customRequestHeaders:      0,
+				templatedRequestHeaders:   0,
+				clientCertHeaders:         0,
 				internalServicePort:       0,
 				servicePort:               0,
 				externalServicePort:       0,
 				neg:                       0,
+				h2cBackend:                0,
+				httpsBackend:              0,
+				negDefaultHealthCheck:     0,
+				negPortMismatch:           0,
+				negCustomPortName:         0,
+				capacityOverride:          0,
 			},
 		},
 		{
@@ -553,40 +626,106 @@ func TestComputeIngressMetrics(t *testing.T) {
 				NewIngressState(ingressStates[11].ing, ingressStates[11].svcPorts),
 			},
 			map[feature]int{
-				backendConnectionDraining: 1,
-				backendTimeout:            0,
-				clientIPAffinity:          0,
-				cloudArmor:                0,
-				cloudCDN:                  0,
-				cloudIAP:                  1,
-				cookieAffinity:            1,
-				customRequestHeaders:      0,
-				externalIngress:           3,
-				httpEnabled:               3,
-				hostBasedRouting:          2,
-				ingress:                   4,
-				internalIngress:           1,
-				managedCertsForTLS:        0,
-				neg:                       1,
-				pathBasedRouting:          1,
-				preSharedCertsForTLS:      0,
-				secretBasedCertsForTLS:    0,
-				staticGlobalIP:            0,
-				tlsTermination:            0,
+				backendConnectionDraining:   1,
+				drainingDisabled:            0,
+				drainingTimeoutClamped:      0,
+				inconsistentDrainTimeout:    0,
+				backendTimeout:              0,
+				clientIPAffinity:            0,
+				cloudArmor:                  0,
+				cloudCDN:                    0,
+				cdnBypassHeaders:            0,
+				cdnServeWhileStale:          0,
+				cdnWithIap:                  0,
+				cloudIAP:                    1,
+				iapOpenAccess:               1,
+				cookieAffinity:              1,
+				generatedCookieAffinity:     1,
+				explicitNoAffinity:          0,
+				igAffinity:                  0,
+				customRequestHeaders:        0,
+				templatedRequestHeaders:     0,
+				clientCertHeaders:           0,
+				externalIngress:             3,
+				httpEnabled:                 3,
+				hostBasedRouting:            2,
+				hostNameTooLong:             0,
+				emptyExplicitRules:          0,
+				crossNamespaceBackend:       0,
+				certExpiringSoon:            0,
+				tlsHostCertMismatch:         0,
+				certNameCollision:           0,
+				weakTLSPolicy:               0,
+				customDefaultBackend:        0,
+				ingressTimeout:              0,
+				iapWithoutTLS:               1,
+				redirectWithoutHTTP:         0,
+				redirectingHTTP:             0,
+				ingress:                     4,
+				internalIngress:             1,
+				ilbGlobalAccess:             0,
+				conflictingIngressClass:     0,
+				alphaIngressClass:           0,
+				managedCertsForTLS:          0,
+				wildcardManagedCert:         0,
+				managedCertLimitRisk:        0,
+				regionalManagedCertsForTLS:  0,
+				conflictingManagedCertScope: 0,
+				externalCertMap:             0,
+				neg:                         1,
+				h2cBackend:                  0,
+				httpsBackend:                0,
+				negDefaultHealthCheck:       1,
+				negPortMismatch:             0,
+				negCustomPortName:           0,
+				capacityOverride:            0,
+				pathBasedRouting:            1,
+				hostlessPathRules:           0,
+				namedServicePort:            0,
+				numberedServicePort:         1,
+				preSharedCertsForTLS:        0,
+				duplicatePreSharedCerts:     0,
+				secretBasedCertsForTLS:      0,
+				crossNamespaceSecret:        0,
+				staticGlobalIP:              0,
+				malformedStaticIP:           0,
+				staticIPWithoutTLS:          0,
+				staticIPConflict:            0,
+				trafficSplitting:            0,
+				tlsTermination:              0,
+				dualProtocol:                0,
 			},
 			map[feature]int{
 				backendConnectionDraining: 1,
+				drainingDisabled:          0,
+				drainingTimeoutClamped:    0,
+				inconsistentDrainTimeout:  0,
 				backendTimeout:            0,
 				clientIPAffinity:          0,
 				cloudArmor:                0,
 				cloudCDN:                  0,
+				cdnBypassHeaders:          0,
+				cdnServeWhileStale:        0,
+				cdnWithIap:                0,
 				cloudIAP:                  1,
+				iapOpenAccess:             1,
 				cookieAffinity:            1,
+				generatedCookieAffinity:   1,
+				explicitNoAffinity:        0,
+				igAffinity:                0,
 				customRequestHeaders:      0,
+				templatedRequestHeaders:   0,
+				clientCertHeaders:         0,
 				internalServicePort:       2,
 				servicePort:               2,
 				externalServicePort:       0,
 				neg:                       2,
+				h2cBackend:                0,
+				httpsBackend:              0,
+				negDefaultHealthCheck:     2,
+				negPortMismatch:           0,
+				negCustomPortName:         0,
+				capacityOverride:          0,
 			},
 		},
 		{
@@ -599,40 +738,106 @@ func TestComputeIngressMetrics(t *testing.T) {
 				NewIngressState(ingressStates[10].ing, ingressStates[10].svcPorts),
 			},
 			map[feature]int{
-				backendConnectionDraining: 4,
-				backendTimeout:            1,
-				clientIPAffinity:          1,
-				cloudArmor:                4,
-				cloudCDN:                  4,
-				cloudIAP:                  1,
-				cookieAffinity:            4,
-				customRequestHeaders:      1,
-				externalIngress:           5,
-				httpEnabled:               5,
-				hostBasedRouting:          1,
-				ingress:                   5,
-				internalIngress:           0,
-				managedCertsForTLS:        1,
-				neg:                       1,
-				pathBasedRouting:          1,
-				preSharedCertsForTLS:      3,
-				secretBasedCertsForTLS:    0,
-				staticGlobalIP:            1,
-				tlsTermination:            3,
+				backendConnectionDraining:   4,
+				drainingDisabled:            0,
+				drainingTimeoutClamped:      0,
+				inconsistentDrainTimeout:    0,
+				backendTimeout:              1,
+				clientIPAffinity:            1,
+				cloudArmor:                  4,
+				cloudCDN:                    4,
+				cdnBypassHeaders:            0,
+				cdnServeWhileStale:          0,
+				cdnWithIap:                  0,
+				cloudIAP:                    1,
+				iapOpenAccess:               1,
+				cookieAffinity:              4,
+				generatedCookieAffinity:     4,
+				explicitNoAffinity:          0,
+				igAffinity:                  4,
+				customRequestHeaders:        1,
+				templatedRequestHeaders:     0,
+				clientCertHeaders:           0,
+				externalIngress:             5,
+				httpEnabled:                 5,
+				hostBasedRouting:            1,
+				hostNameTooLong:             0,
+				emptyExplicitRules:          4,
+				crossNamespaceBackend:       0,
+				certExpiringSoon:            0,
+				tlsHostCertMismatch:         0,
+				certNameCollision:           0,
+				weakTLSPolicy:               0,
+				customDefaultBackend:        0,
+				ingressTimeout:              0,
+				iapWithoutTLS:               1,
+				redirectWithoutHTTP:         0,
+				redirectingHTTP:             0,
+				ingress:                     5,
+				internalIngress:             0,
+				ilbGlobalAccess:             0,
+				conflictingIngressClass:     0,
+				alphaIngressClass:           0,
+				managedCertsForTLS:          1,
+				wildcardManagedCert:         0,
+				managedCertLimitRisk:        0,
+				regionalManagedCertsForTLS:  0,
+				conflictingManagedCertScope: 0,
+				externalCertMap:             0,
+				neg:                         1,
+				h2cBackend:                  0,
+				httpsBackend:                0,
+				negDefaultHealthCheck:       1,
+				negPortMismatch:             0,
+				negCustomPortName:           0,
+				capacityOverride:            0,
+				pathBasedRouting:            1,
+				hostlessPathRules:           0,
+				namedServicePort:            0,
+				numberedServicePort:         5,
+				preSharedCertsForTLS:        3,
+				duplicatePreSharedCerts:     0,
+				secretBasedCertsForTLS:      0,
+				crossNamespaceSecret:        0,
+				staticGlobalIP:              1,
+				malformedStaticIP:           0,
+				staticIPWithoutTLS:          0,
+				staticIPConflict:            0,
+				trafficSplitting:            0,
+				tlsTermination:              3,
+				dualProtocol:                3,
 			},
 			map[feature]int{
 				backendConnectionDraining: 1,
+				drainingDisabled:          0,
+				drainingTimeoutClamped:    0,
+				inconsistentDrainTimeout:  0,
 				backendTimeout:            1,
 				clientIPAffinity:          1,
 				cloudArmor:                1,
 				cloudCDN:                  1,
+				cdnBypassHeaders:          0,
+				cdnServeWhileStale:        0,
+				cdnWithIap:                0,
 				cloudIAP:                  1,
+				iapOpenAccess:             1,
 				cookieAffinity:            1,
+				generatedCookieAffinity:   1,
+				explicitNoAffinity:        0,
+				igAffinity:                1,
 				customRequestHeaders:      1,
+				templatedRequestHeaders:   0,
+				clientCertHeaders:         0,
 				internalServicePort:       0,
 				servicePort:               2,
 				externalServicePort:       2,
 				neg:                       1,
+				h2cBackend:                0,
+				httpsBackend:              0,
+				negDefaultHealthCheck:     1,
+				negPortMismatch:           0,
+				negCustomPortName:         0,
+				capacityOverride:          0,
 			},
 		},
 		{
@@ -652,40 +857,106 @@ func TestComputeIngressMetrics(t *testing.T) {
 				NewIngressState(ingressStates[11].ing, ingressStates[11].svcPorts),
 			},
 			map[feature]int{
-				backendConnectionDraining: 7,
-				backendTimeout:            3,
-				clientIPAffinity:          3,
-				cloudArmor:                6,
-				cloudCDN:                  6,
-				cloudIAP:                  4,
-				cookieAffinity:            7,
-				customRequestHeaders:      3,
-				externalIngress:           11,
-				httpEnabled:               11,
-				hostBasedRouting:          5,
-				ingress:                   12,
-				internalIngress:           1,
-				managedCertsForTLS:        2,
-				neg:                       4,
-				pathBasedRouting:          4,
-				preSharedCertsForTLS:      4,
-				secretBasedCertsForTLS:    1,
-				staticGlobalIP:            1,
-				tlsTermination:            5,
+				backendConnectionDraining:   7,
+				drainingDisabled:            0,
+				drainingTimeoutClamped:      0,
+				inconsistentDrainTimeout:    0,
+				backendTimeout:              3,
+				clientIPAffinity:            3,
+				cloudArmor:                  6,
+				cloudCDN:                    6,
+				cdnBypassHeaders:            0,
+				cdnServeWhileStale:          0,
+				cdnWithIap:                  0,
+				cloudIAP:                    4,
+				iapOpenAccess:               4,
+				cookieAffinity:              7,
+				generatedCookieAffinity:     7,
+				explicitNoAffinity:          0,
+				igAffinity:                  6,
+				customRequestHeaders:        3,
+				templatedRequestHeaders:     0,
+				clientCertHeaders:           0,
+				externalIngress:             11,
+				httpEnabled:                 11,
+				hostBasedRouting:            5,
+				hostNameTooLong:             0,
+				emptyExplicitRules:          5,
+				crossNamespaceBackend:       0,
+				certExpiringSoon:            0,
+				tlsHostCertMismatch:         0,
+				certNameCollision:           0,
+				weakTLSPolicy:               0,
+				customDefaultBackend:        0,
+				ingressTimeout:              0,
+				iapWithoutTLS:               3,
+				redirectWithoutHTTP:         0,
+				redirectingHTTP:             0,
+				ingress:                     12,
+				internalIngress:             1,
+				ilbGlobalAccess:             0,
+				conflictingIngressClass:     0,
+				alphaIngressClass:           0,
+				managedCertsForTLS:          2,
+				wildcardManagedCert:         0,
+				managedCertLimitRisk:        0,
+				regionalManagedCertsForTLS:  0,
+				conflictingManagedCertScope: 0,
+				externalCertMap:             0,
+				neg:                         4,
+				h2cBackend:                  0,
+				httpsBackend:                0,
+				negDefaultHealthCheck:       4,
+				negPortMismatch:             0,
+				negCustomPortName:           0,
+				capacityOverride:            0,
+				pathBasedRouting:            4,
+				hostlessPathRules:           0,
+				namedServicePort:            0,
+				numberedServicePort:         9,
+				preSharedCertsForTLS:        4,
+				duplicatePreSharedCerts:     0,
+				secretBasedCertsForTLS:      1,
+				crossNamespaceSecret:        0,
+				staticGlobalIP:              1,
+				malformedStaticIP:           0,
+				staticIPWithoutTLS:          0,
+				staticIPConflict:            0,
+				trafficSplitting:            0,
+				tlsTermination:              5,
+				dualProtocol:                5,
 			},
 			map[feature]int{
 				backendConnectionDraining: 2,
+				drainingDisabled:          0,
+				drainingTimeoutClamped:    0,
+				inconsistentDrainTimeout:  0,
 				backendTimeout:            1,
 				clientIPAffinity:          1,
 				cloudArmor:                1,
 				cloudCDN:                  1,
+				cdnBypassHeaders:          0,
+				cdnServeWhileStale:        0,
+				cdnWithIap:                0,
 				cloudIAP:                  2,
+				iapOpenAccess:             2,
 				cookieAffinity:            2,
+				generatedCookieAffinity:   2,
+				explicitNoAffinity:        0,
+				igAffinity:                1,
 				customRequestHeaders:      1,
+				templatedRequestHeaders:   0,
+				clientCertHeaders:         0,
 				internalServicePort:       2,
 				servicePort:               4,
 				externalServicePort:       2,
 				neg:                       3,
+				h2cBackend:                0,
+				httpsBackend:              0,
+				negDefaultHealthCheck:     3,
+				negPortMismatch:           0,
+				negCustomPortName:         0,
+				capacityOverride:          0,
 			},
 		},
 	} {
@@ -708,66 +979,2194 @@ func TestComputeIngressMetrics(t *testing.T) {
 	}
 }
 
-func TestComputeNegMetrics(t *testing.T) {
+// hasFeature returns true if the given feature list contains f.
+func hasFeature(features []feature, f feature) bool {
+	for _, ftr := range features {
+		if ftr == f {
+			return true
+		}
+	}
+	return false
+}
+
+func TestH2CBackend(t *testing.T) {
 	t.Parallel()
+	healthCheckType := "HTTP2"
 	for _, tc := range []struct {
-		desc           string
-		negStates      []NegServiceState
-		expectNegCount map[feature]int
+		desc          string
+		svcPort       utils.ServicePort
+		expectFeature bool
 	}{
 		{
-			"empty input",
-			[]NegServiceState{},
-			map[feature]int{
-				standaloneNeg: 0,
-				ingressNeg:    0,
-				asmNeg:        0,
-				neg:           0,
+			"HTTP2 port with cleartext backend",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "h2c-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(443),
+				},
+				Protocol: annotations.ProtocolHTTP2,
 			},
+			true,
 		},
 		{
-			"one neg service",
-			[]NegServiceState{
-				newNegState(0, 0, 1),
+			"HTTP2 port with secure backend",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "h2-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(443),
+				},
+				Protocol: annotations.ProtocolHTTP2,
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						HealthCheck: &backendconfigv1.HealthCheckConfig{
+							Type: &healthCheckType,
+						},
+					},
+				},
 			},
-			map[feature]int{
-				standaloneNeg: 0,
-				ingressNeg:    0,
-				asmNeg:        1,
-				neg:           1,
+			false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if gotFeature := hasFeature(featuresForServicePort(tc.svcPort), h2cBackend); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", h2cBackend, gotFeature, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestHttpsBackend(t *testing.T) {
+	t.Parallel()
+	httpsPort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "https-service",
+				Namespace: defaultNamespace,
+			},
+			Port: intstr.FromInt(443),
+		},
+		Protocol: annotations.ProtocolHTTPS,
+	}
+	if !hasFeature(featuresForServicePort(httpsPort), httpsBackend) {
+		t.Errorf("Expected feature %s for service port with HTTPS backend protocol", httpsBackend)
+	}
+	// Fixture port 1 leaves the protocol unset and defaults to HTTP.
+	if hasFeature(featuresForServicePort(testServicePorts[1]), httpsBackend) {
+		t.Errorf("Unexpected feature %s for service port with HTTP backend protocol", httpsBackend)
+	}
+}
+
+func TestDualProtocol(t *testing.T) {
+	t.Parallel()
+	// Fixture ingress6 has certs and leaves HTTP enabled by default.
+	if !hasFeature(featuresForIngress(ingressStates[6].ing), dualProtocol) {
+		t.Errorf("Expected feature %s for ingress serving both http and https", dualProtocol)
+	}
+	httpsOnlyIng := ingressStates[6].ing.DeepCopy()
+	httpsOnlyIng.Annotations[allowHTTPKey] = "false"
+	if hasFeature(featuresForIngress(httpsOnlyIng), dualProtocol) {
+		t.Errorf("Unexpected feature %s for https-only ingress", dualProtocol)
+	}
+	// An ingress without TLS termination only serves http.
+	if hasFeature(featuresForIngress(ingressStates[0].ing), dualProtocol) {
+		t.Errorf("Unexpected feature %s for http-only ingress", dualProtocol)
+	}
+}
+
+func TestComputeRedirectResponseCodeCounts(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, responseCode := range []string{"", "FOUND", "TEMPORARY_REDIRECT", "FOUND"} {
+		redirectFeConfig := &frontendconfigv1beta1.FrontendConfig{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: defaultNamespace,
+				Name:      fmt.Sprintf("redirect-config%d", i),
+			},
+			Spec: frontendconfigv1beta1.FrontendConfigSpec{
+				RedirectToHttps: &frontendconfigv1beta1.HttpsRedirectConfig{
+					Enabled:          true,
+					ResponseCodeName: responseCode,
+				},
+			},
+		}
+		ingKey := fmt.Sprintf("%s/redirect-ingress%d", defaultNamespace, i)
+		newMetrics.SetIngress(ingKey, NewIngressStateWithFrontendConfig(ingressStates[0].ing, redirectFeConfig, nil))
+	}
+	// An ingress without a redirecting frontend config does not contribute.
+	newMetrics.SetIngress("default/plain-ingress", NewIngressState(ingressStates[1].ing, nil))
+
+	expectCounts := map[string]int{
+		"MOVED_PERMANENTLY_DEFAULT": 1,
+		"FOUND":                     2,
+		"TEMPORARY_REDIRECT":        1,
+	}
+	if diff := cmp.Diff(expectCounts, newMetrics.computeRedirectResponseCodeCounts()); diff != "" {
+		t.Errorf("Got diff for redirect response code counts (-want +got):\n%s", diff)
+	}
+}
+
+func TestRedirectWithoutHTTP(t *testing.T) {
+	t.Parallel()
+	redirectFeConfig := &frontendconfigv1beta1.FrontendConfig{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "redirect-config",
+		},
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{
+			RedirectToHttps: &frontendconfigv1beta1.HttpsRedirectConfig{
+				Enabled: true,
+			},
+		},
+	}
+	// Fixture ingress1 disables http while ingress0 leaves it enabled.
+	brokenState := NewIngressStateWithFrontendConfig(ingressStates[1].ing, redirectFeConfig, nil)
+	if !featuresForIngressState(brokenState)[redirectWithoutHTTP] {
+		t.Errorf("Expected feature %s for https redirect with http disabled", redirectWithoutHTTP)
+	}
+	workingState := NewIngressStateWithFrontendConfig(ingressStates[0].ing, redirectFeConfig, nil)
+	if featuresForIngressState(workingState)[redirectWithoutHTTP] {
+		t.Errorf("Unexpected feature %s for https redirect with http enabled", redirectWithoutHTTP)
+	}
+	if featuresForIngressState(NewIngressState(ingressStates[1].ing, nil))[redirectWithoutHTTP] {
+		t.Errorf("Unexpected feature %s for ingress without a frontend config", redirectWithoutHTTP)
+	}
+}
+
+func TestRedirectingHTTP(t *testing.T) {
+	t.Parallel()
+	redirectFeConfig := &frontendconfigv1beta1.FrontendConfig{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "redirect-config",
+		},
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{
+			RedirectToHttps: &frontendconfigv1beta1.HttpsRedirectConfig{
+				Enabled: true,
+			},
+		},
+	}
+	// Fixture ingress0 serves http while ingress1 disables it.
+	redirectingState := NewIngressStateWithFrontendConfig(ingressStates[0].ing, redirectFeConfig, nil)
+	if !featuresForIngressState(redirectingState)[redirectingHTTP] {
+		t.Errorf("Expected feature %s for https redirect with http enabled", redirectingHTTP)
+	}
+	httpOffState := NewIngressStateWithFrontendConfig(ingressStates[1].ing, redirectFeConfig, nil)
+	if featuresForIngressState(httpOffState)[redirectingHTTP] {
+		t.Errorf("Unexpected feature %s for https redirect with http disabled", redirectingHTTP)
+	}
+	if featuresForIngressState(NewIngressState(ingressStates[0].ing, nil))[redirectingHTTP] {
+		t.Errorf("Unexpected feature %s for ingress without a frontend config", redirectingHTTP)
+	}
+}
+
+func TestComputeIapAndArmorBackends(t *testing.T) {
+	t.Parallel()
+	defenseInDepthPort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "defended-service",
+				Namespace: defaultNamespace,
+			},
+			Port: intstr.FromInt(443),
+		},
+		BackendConfig: &backendconfigv1.BackendConfig{
+			Spec: backendconfigv1.BackendConfigSpec{
+				Iap: &backendconfigv1.IAPConfig{
+					Enabled: true,
+				},
+				SecurityPolicy: &backendconfigv1.SecurityPolicyConfig{
+					Name: "security-policy-1",
+				},
+			},
+		},
+	}
+	newMetrics := NewControllerMetrics()
+	// Fixture port 0 enables Cloud Armor only and port 1 enables IAP only.
+	newMetrics.SetIngress("default/defended", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], testServicePorts[1], defenseInDepthPort}))
+	// A service port shared by another ingress is counted once.
+	newMetrics.SetIngress("default/shared", NewIngressState(ingressStates[2].ing, []utils.ServicePort{defenseInDepthPort}))
+
+	if gotCount := newMetrics.computeIapAndArmorBackends(); gotCount != 1 {
+		t.Errorf("Got %d service ports with both IAP and Cloud Armor, want 1", gotCount)
+	}
+}
+
+func TestCrossNamespaceBackend(t *testing.T) {
+	t.Parallel()
+	foreignPort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "foreign-service",
+				Namespace: "other-namespace",
+			},
+			Port: intstr.FromInt(80),
+		},
+	}
+	brokenState := NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], foreignPort})
+	if !featuresForIngressState(brokenState)[crossNamespaceBackend] {
+		t.Errorf("Expected feature %s for ingress backed by a service in namespace %q", crossNamespaceBackend, foreignPort.ID.Service.Namespace)
+	}
+	workingState := NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0]})
+	if featuresForIngressState(workingState)[crossNamespaceBackend] {
+		t.Errorf("Unexpected feature %s for ingress backed by services in its own namespace", crossNamespaceBackend)
+	}
+}
+
+func TestIapOpenAccess(t *testing.T) {
+	t.Parallel()
+	// Fixture port 1 enables IAP without OAuth client credentials.
+	if !hasFeature(featuresForServicePort(testServicePorts[1]), iapOpenAccess) {
+		t.Errorf("Expected feature %s for IAP service port without OAuth client credentials", iapOpenAccess)
+	}
+	restrictedPort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "iap-service",
+				Namespace: defaultNamespace,
+			},
+			Port: intstr.FromInt(80),
+		},
+		BackendConfig: &backendconfigv1.BackendConfig{
+			Spec: backendconfigv1.BackendConfigSpec{
+				Iap: &backendconfigv1.IAPConfig{
+					Enabled: true,
+					OAuthClientCredentials: &backendconfigv1.OAuthClientCredentials{
+						SecretName: "oauth-secret",
+					},
+				},
 			},
 		},
+	}
+	if hasFeature(featuresForServicePort(restrictedPort), iapOpenAccess) {
+		t.Errorf("Unexpected feature %s for IAP service port with OAuth client credentials", iapOpenAccess)
+	}
+}
+
+func TestNegDefaultHealthCheck(t *testing.T) {
+	t.Parallel()
+	healthCheckType := "HTTPS"
+	for _, tc := range []struct {
+		desc          string
+		svcPort       utils.ServicePort
+		expectFeature bool
+	}{
 		{
-			"many neg services",
-			[]NegServiceState{
-				newNegState(0, 0, 1),
-				newNegState(0, 1, 0),
-				newNegState(5, 0, 0),
-				newNegState(5, 3, 2),
+			"NEG without a backend config",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				NEGEnabled: true,
 			},
-			map[feature]int{
-				standaloneNeg: 10,
-				ingressNeg:    4,
-				asmNeg:        3,
-				neg:           17,
+			true,
+		},
+		{
+			"NEG without a custom health check",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				NEGEnabled:    true,
+				BackendConfig: &backendconfigv1.BackendConfig{},
+			},
+			true,
+		},
+		{
+			"NEG with a custom health check",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				NEGEnabled: true,
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						HealthCheck: &backendconfigv1.HealthCheckConfig{
+							Type: &healthCheckType,
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"custom health check without NEG",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "vm-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
 			},
+			false,
 		},
 	} {
 		tc := tc
 		t.Run(tc.desc, func(t *testing.T) {
 			t.Parallel()
-			newMetrics := NewControllerMetrics()
-			for i, negState := range tc.negStates {
-				newMetrics.SetNegService(string(i), negState)
+			if gotFeature := hasFeature(featuresForServicePort(tc.svcPort), negDefaultHealthCheck); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", negDefaultHealthCheck, gotFeature, tc.expectFeature)
 			}
-			output := newMetrics.computeNegMetrics()
-			if !reflect.DeepEqual(output, tc.expectNegCount) {
-				t.Errorf("For case %q, expect output %v, but got %v", tc.desc, tc.expectNegCount, output)
+		})
+	}
+}
+
+func TestCrossNamespaceSecret(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		secretName    string
+		expectFeature bool
+	}{
+		{"plain secret name", "tls-secret", false},
+		{"secret qualified with the ingress namespace", defaultNamespace + "/tls-secret", false},
+		{"secret qualified with another namespace", "other/tls-secret", true},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			ing := ingressStates[0].ing.DeepCopy()
+			ing.Spec.TLS = []v1beta1.IngressTLS{{SecretName: tc.secretName}}
+			if gotFeature := hasFeature(featuresForIngress(ing), crossNamespaceSecret); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", crossNamespaceSecret, gotFeature, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestCustomDefaultBackend(t *testing.T) {
+	t.Parallel()
+	customIng := ingressStates[2].ing.DeepCopy()
+	customIng.Annotations = map[string]string{customDefaultBackendKey: "error-backend"}
+	if !hasFeature(featuresForIngress(customIng), customDefaultBackend) {
+		t.Errorf("Expected feature %s for ingress with the %s annotation", customDefaultBackend, customDefaultBackendKey)
+	}
+	// A plain spec level default backend does not count as custom.
+	if hasFeature(featuresForIngress(ingressStates[2].ing), customDefaultBackend) {
+		t.Errorf("Unexpected feature %s for ingress without the %s annotation", customDefaultBackend, customDefaultBackendKey)
+	}
+}
+
+func TestHostNameTooLong(t *testing.T) {
+	t.Parallel()
+	longHostIng := ingressStates[3].ing.DeepCopy()
+	longHostIng.Spec.Rules[0].Host = fmt.Sprintf("%s.example.com", strings.Repeat("a", hostNameLengthLimit))
+	if !hasFeature(featuresForIngress(longHostIng), hostNameTooLong) {
+		t.Errorf("Expected feature %s for ingress with a %d character host", hostNameTooLong, len(longHostIng.Spec.Rules[0].Host))
+	}
+	if hasFeature(featuresForIngress(ingressStates[3].ing), hostNameTooLong) {
+		t.Errorf("Unexpected feature %s for ingress with host %q", hostNameTooLong, ingressStates[3].ing.Spec.Rules[0].Host)
+	}
+}
+
+func TestHostlessPathRules(t *testing.T) {
+	t.Parallel()
+	hostlessIng := ingressStates[4].ing.DeepCopy()
+	hostlessIng.Spec.Rules[0].Host = ""
+	if !hasFeature(featuresForIngress(hostlessIng), hostlessPathRules) {
+		t.Errorf("Expected feature %s for ingress with a hostless path rule", hostlessPathRules)
+	}
+	// A rule with both a host and paths does not trigger the feature.
+	if hasFeature(featuresForIngress(ingressStates[4].ing), hostlessPathRules) {
+		t.Errorf("Unexpected feature %s for ingress with host %q on its path rule", hostlessPathRules, ingressStates[4].ing.Spec.Rules[0].Host)
+	}
+}
+
+func TestServicePortReferenceType(t *testing.T) {
+	t.Parallel()
+	namedPortIng := ingressStates[4].ing.DeepCopy()
+	namedPortIng.Spec.Rules[0].HTTP.Paths[0].Backend.ServicePort = intstr.FromString("web")
+	gotFeatures := featuresForIngress(namedPortIng)
+	if !hasFeature(gotFeatures, namedServicePort) {
+		t.Errorf("Expected feature %s for ingress referencing a service port by name", namedServicePort)
+	}
+	if hasFeature(gotFeatures, numberedServicePort) {
+		t.Errorf("Unexpected feature %s for ingress referencing a service port by name only", numberedServicePort)
+	}
+	gotFeatures = featuresForIngress(ingressStates[4].ing)
+	if !hasFeature(gotFeatures, numberedServicePort) {
+		t.Errorf("Expected feature %s for ingress referencing a service port by number", numberedServicePort)
+	}
+	if hasFeature(gotFeatures, namedServicePort) {
+		t.Errorf("Unexpected feature %s for ingress referencing a service port by number only", namedServicePort)
+	}
+}
+
+func TestManagedCertLimitRisk(t *testing.T) {
+	t.Parallel()
+	manyCerts := make([]string, 12)
+	for i := range manyCerts {
+		manyCerts[i] = fmt.Sprintf("cert%d", i)
+	}
+	riskyIng := ingressStates[0].ing.DeepCopy()
+	riskyIng.Annotations = map[string]string{managedCertKey: strings.Join(manyCerts, ",")}
+	if !hasFeature(featuresForIngress(riskyIng), managedCertLimitRisk) {
+		t.Errorf("Expected feature %s for ingress with %d managed certs", managedCertLimitRisk, len(manyCerts))
+	}
+	modestIng := ingressStates[0].ing.DeepCopy()
+	modestIng.Annotations = map[string]string{managedCertKey: "cert1,cert2,cert3"}
+	if hasFeature(featuresForIngress(modestIng), managedCertLimitRisk) {
+		t.Errorf("Unexpected feature %s for ingress with 3 managed certs", managedCertLimitRisk)
+	}
+}
+
+func TestTlsHostCertMismatch(t *testing.T) {
+	t.Parallel()
+	// Fixture ingress9 carries one TLS host covered by one secret cert and
+	// two pre-shared certs.
+	mismatchIng := ingressStates[9].ing.DeepCopy()
+	delete(mismatchIng.Annotations, preSharedCertKey)
+	mismatchIng.Spec.TLS[0].Hosts = []string{"foo.bar", "bar.baz", "baz.qux"}
+	if !hasFeature(featuresForIngress(mismatchIng), tlsHostCertMismatch) {
+		t.Errorf("Expected feature %s for ingress with 3 TLS hosts and 1 cert", tlsHostCertMismatch)
+	}
+	if hasFeature(featuresForIngress(ingressStates[9].ing), tlsHostCertMismatch) {
+		t.Errorf("Unexpected feature %s for ingress with as many certs as TLS hosts", tlsHostCertMismatch)
+	}
+}
+
+func TestExternalCertMap(t *testing.T) {
+	t.Parallel()
+	certMapIng := ingressStates[0].ing.DeepCopy()
+	certMapIng.Annotations = map[string]string{certMapKey: "cert-map-1"}
+	if !hasFeature(featuresForIngress(certMapIng), externalCertMap) {
+		t.Errorf("Expected feature %s for ingress with the annotation %s", externalCertMap, certMapKey)
+	}
+	if hasFeature(featuresForIngress(ingressStates[9].ing), externalCertMap) {
+		t.Errorf("Unexpected feature %s for ingress using built-in cert sources", externalCertMap)
+	}
+}
+
+func TestCertNameCollision(t *testing.T) {
+	t.Parallel()
+	// Fixture ingress9 terminates TLS with the secret cert "secret-1".
+	collisionIng := ingressStates[9].ing.DeepCopy()
+	collisionIng.Annotations[managedCertKey] = "managed-cert-1,secret-1"
+	if !hasFeature(featuresForIngress(collisionIng), certNameCollision) {
+		t.Errorf("Expected feature %s for ingress whose TLS secret name matches a managed cert name", certNameCollision)
+	}
+	noCollisionIng := ingressStates[9].ing.DeepCopy()
+	noCollisionIng.Annotations[managedCertKey] = "managed-cert-1"
+	if hasFeature(featuresForIngress(noCollisionIng), certNameCollision) {
+		t.Errorf("Unexpected feature %s for ingress with distinct secret and managed cert names", certNameCollision)
+	}
+}
+
+func TestFeaturesForIngressState(t *testing.T) {
+	t.Parallel()
+	for _, tc := range ingressStates {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			gotFrontend, gotBackend := FeaturesForIngressState(NewIngressState(tc.ing, tc.svcPorts))
+			if diff := cmp.Diff(tc.frontendFeatures, gotFrontend); diff != "" {
+				t.Errorf("Got diff for frontend features (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.backendFeatures, gotBackend); diff != "" {
+				t.Errorf("Got diff for backend features (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
+func TestWeakTLSPolicy(t *testing.T) {
+	t.Parallel()
+	weakState := NewIngressState(ingressStates[5].ing, nil)
+	weakState.SetSSLPolicyMinTLSVersion("TLS_1_0")
+	if !featuresForIngressState(weakState)[weakTLSPolicy] {
+		t.Errorf("Expected feature %s for ingress with a TLS 1.0 SSL policy", weakTLSPolicy)
+	}
+	strongState := NewIngressState(ingressStates[5].ing, nil)
+	strongState.SetSSLPolicyMinTLSVersion("TLS_1_2")
+	if featuresForIngressState(strongState)[weakTLSPolicy] {
+		t.Errorf("Unexpected feature %s for ingress with a TLS 1.2 SSL policy", weakTLSPolicy)
+	}
+}
+
+func TestCertExpiringSoon(t *testing.T) {
+	t.Parallel()
+	expiringState := NewIngressState(ingressStates[5].ing, nil)
+	expiringState.SetCertExpiries([]time.Time{time.Now().Add(3 * 24 * time.Hour)})
+	if !featuresForIngressState(expiringState)[certExpiringSoon] {
+		t.Errorf("Expected feature %s for ingress with a cert expiring in 3 days", certExpiringSoon)
+	}
+	healthyState := NewIngressState(ingressStates[5].ing, nil)
+	healthyState.SetCertExpiries([]time.Time{time.Now().Add(90 * 24 * time.Hour)})
+	if featuresForIngressState(healthyState)[certExpiringSoon] {
+		t.Errorf("Unexpected feature %s for ingress with a cert expiring in 90 days", certExpiringSoon)
+	}
+}
+
+func TestIlbGlobalAccess(t *testing.T) {
+	t.Parallel()
+	globalAccessIng := ingressStates[11].ing.DeepCopy()
+	globalAccessIng.Annotations[globalAccessKey] = "true"
+	if !hasFeature(featuresForIngress(globalAccessIng), ilbGlobalAccess) {
+		t.Errorf("Expected feature %s for internal ingress with the global access annotation", ilbGlobalAccess)
+	}
+	if hasFeature(featuresForIngress(ingressStates[11].ing), ilbGlobalAccess) {
+		t.Errorf("Unexpected feature %s for internal ingress without the global access annotation", ilbGlobalAccess)
+	}
+	// The annotation has no effect on external ingresses.
+	externalIng := ingressStates[0].ing.DeepCopy()
+	externalIng.Annotations = map[string]string{globalAccessKey: "true"}
+	if hasFeature(featuresForIngress(externalIng), ilbGlobalAccess) {
+		t.Errorf("Unexpected feature %s for external ingress with the global access annotation", ilbGlobalAccess)
+	}
+}
+
+func TestConflictingIngressClass(t *testing.T) {
+	t.Parallel()
+	// An external class combined with the internal-only global access
+	// annotation is conflicting; the class annotation wins.
+	conflictedIng := ingressStates[0].ing.DeepCopy()
+	conflictedIng.Annotations = map[string]string{
+		ingressClassKey: gceIngressClass,
+		globalAccessKey: "true",
+	}
+	gotFeatures := featuresForIngress(conflictedIng)
+	if !hasFeature(gotFeatures, conflictingIngressClass) {
+		t.Errorf("Expected feature %s for external ingress with the annotation %s", conflictingIngressClass, globalAccessKey)
+	}
+	if !hasFeature(gotFeatures, externalIngress) {
+		t.Errorf("Expected conflicted ingress to resolve to feature %s", externalIngress)
+	}
+	// On an internal ingress the global access annotation is not a conflict.
+	globalAccessIng := ingressStates[11].ing.DeepCopy()
+	globalAccessIng.Annotations[globalAccessKey] = "true"
+	if hasFeature(featuresForIngress(globalAccessIng), conflictingIngressClass) {
+		t.Errorf("Unexpected feature %s for internal ingress with the annotation %s", conflictingIngressClass, globalAccessKey)
+	}
+}
+
+func TestAlphaIngressClass(t *testing.T) {
+	t.Parallel()
+	alphaIng := ingressStates[0].ing.DeepCopy()
+	alphaIng.Annotations = map[string]string{ingressClassKey: alphaIngressClassName}
+	if !hasFeature(featuresForIngress(alphaIng), alphaIngressClass) {
+		t.Errorf("Expected feature %s for ingress with class %s", alphaIngressClass, alphaIngressClassName)
+	}
+	// Neither the implicit default class nor the internal class are alpha.
+	if hasFeature(featuresForIngress(ingressStates[0].ing), alphaIngressClass) {
+		t.Errorf("Unexpected feature %s for ingress without an ingress class", alphaIngressClass)
+	}
+	if hasFeature(featuresForIngress(ingressStates[11].ing), alphaIngressClass) {
+		t.Errorf("Unexpected feature %s for ingress with class %s", alphaIngressClass, gceL7ILBIngressClass)
+	}
+}
+
+func TestMalformedStaticIP(t *testing.T) {
+	t.Parallel()
+	malformedIng := ingressStates[0].ing.DeepCopy()
+	malformedIng.Annotations = map[string]string{staticIPKey: "not-an-ip"}
+	if !hasFeature(featuresForIngress(malformedIng), malformedStaticIP) {
+		t.Errorf("Expected feature %s for ingress with static ip %q", malformedStaticIP, malformedIng.Annotations[staticIPKey])
+	}
+	wellFormedIng := ingressStates[0].ing.DeepCopy()
+	wellFormedIng.Annotations = map[string]string{staticIPKey: "10.0.1.2"}
+	if hasFeature(featuresForIngress(wellFormedIng), malformedStaticIP) {
+		t.Errorf("Unexpected feature %s for ingress with static ip %q", malformedStaticIP, wellFormedIng.Annotations[staticIPKey])
+	}
+}
+
+func TestStaticIPWithoutTLS(t *testing.T) {
+	t.Parallel()
+	plaintextIng := ingressStates[0].ing.DeepCopy()
+	plaintextIng.Annotations = map[string]string{staticIPKey: "10.0.1.2"}
+	if !hasFeature(featuresForIngress(plaintextIng), staticIPWithoutTLS) {
+		t.Errorf("Expected feature %s for ingress with a static ip and no TLS", staticIPWithoutTLS)
+	}
+	// Fixture ingress10 reserves a static ip and terminates TLS with
+	// pre-shared certs.
+	if hasFeature(featuresForIngress(ingressStates[10].ing), staticIPWithoutTLS) {
+		t.Errorf("Unexpected feature %s for ingress with a static ip and pre-shared certs", staticIPWithoutTLS)
+	}
+}
+
+func TestFeatureHistory(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.EnableHistory(2)
+	newMetrics.SetIngress("default/ingress0", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.computeIngressMetrics()
+	newMetrics.SetIngress("default/ingress1", NewIngressState(ingressStates[1].ing, nil))
+	newMetrics.computeIngressMetrics()
+	newMetrics.SetIngress("default/ingress2", NewIngressState(ingressStates[2].ing, nil))
+	newMetrics.computeIngressMetrics()
+
+	// Only the last two computed counts are retained.
+	if diff := cmp.Diff([]int{2, 3}, newMetrics.FeatureHistory(ingress)); diff != "" {
+		t.Errorf("Got diff for history of feature %s (-want +got):\n%s", ingress, diff)
+	}
+	// Features absent from the tracked ingresses retain zero counts.
+	if diff := cmp.Diff([]int{0, 0}, newMetrics.FeatureHistory(cloudCDN)); diff != "" {
+		t.Errorf("Got diff for history of feature %s (-want +got):\n%s", cloudCDN, diff)
+	}
+}
+
+func TestFeatureSimilarity(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress3 carries all 3 features of ingress0 plus host based
+	// routing, so the sets overlap in 3 of 4 features.
+	newMetrics.SetIngress("default/ingress0", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.SetIngress("default/ingress3", NewIngressState(ingressStates[3].ing, nil))
+
+	gotSimilarity, err := newMetrics.FeatureSimilarity("default/ingress0", "default/ingress3")
+	if err != nil {
+		t.Fatalf("FeatureSimilarity() = %v, want nil", err)
+	}
+	if gotSimilarity != 0.75 {
+		t.Errorf("Got similarity %v, want 0.75", gotSimilarity)
+	}
+	if _, err := newMetrics.FeatureSimilarity("default/ingress0", "default/untracked"); err == nil {
+		t.Error("FeatureSimilarity() = nil, want error for untracked ingress")
+	}
+}
+
+func TestRiskFeatures(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress0 serves plaintext http while port 1 enables Cloud IAP.
+	newMetrics.SetIngress("default/risky-ingress", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[1]}))
+	newMetrics.SetIngress("default/safe-ingress", NewIngressState(ingressStates[0].ing, nil))
+
+	if diff := cmp.Diff([]feature{iapWithoutTLS}, newMetrics.RiskFeatures("default/risky-ingress")); diff != "" {
+		t.Errorf("Got diff for risk features (-want +got):\n%s", diff)
+	}
+	if gotFeatures := newMetrics.RiskFeatures("default/safe-ingress"); gotFeatures != nil {
+		t.Errorf("Got risk features %v for a safe ingress, want none", gotFeatures)
+	}
+	if gotFeatures := newMetrics.RiskFeatures("default/untracked-ingress"); gotFeatures != nil {
+		t.Errorf("Got risk features %v for an untracked ingress, want none", gotFeatures)
+	}
+}
+
+func TestReconcileAgainst(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetIngress("default/ingress0", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.SetIngress("default/ingress1", NewIngressState(ingressStates[1].ing, nil))
+
+	// The live list drops ingress1 and carries a new ingress2.
+	liveKeys := []string{"default/ingress0", "default/ingress2"}
+	added, removed := newMetrics.ReconcileAgainst(liveKeys, false)
+	if diff := cmp.Diff([]string{"default/ingress2"}, added); diff != "" {
+		t.Errorf("Got diff for added keys (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"default/ingress1"}, removed); diff != "" {
+		t.Errorf("Got diff for removed keys (-want +got):\n%s", diff)
+	}
+	// Without pruning the stale ingress stays tracked.
+	if ingCount, _ := newMetrics.computeIngressMetrics(); ingCount[ingress] != 2 {
+		t.Errorf("Got %d tracked ingresses after reconciling without pruning, want 2", ingCount[ingress])
+	}
+
+	newMetrics.ReconcileAgainst(liveKeys, true)
+	if ingCount, _ := newMetrics.computeIngressMetrics(); ingCount[ingress] != 1 {
+		t.Errorf("Got %d tracked ingresses after pruning, want 1", ingCount[ingress])
+	}
+}
+
+func TestGetIngressState(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetIngress("default/ingress9", NewIngressState(ingressStates[9].ing, ingressStates[9].svcPorts))
+
+	gotState, ok := newMetrics.GetIngressState("default/ingress9")
+	if !ok {
+		t.Fatalf("GetIngressState(default/ingress9) not found, want found")
+	}
+	if diff := cmp.Diff(ingressStates[9].ing, gotState.ingress); diff != "" {
+		t.Errorf("Got diff for returned ingress (-want +got):\n%s", diff)
+	}
+	// Mutating the returned state must not affect the collector.
+	gotState.ingress.Annotations[staticIPKey] = "10.0.1.2"
+	gotState.servicePorts[0].BackendConfig.Spec.Iap.Enabled = false
+	storedState, _ := newMetrics.GetIngressState("default/ingress9")
+	if hasFeature(featuresForIngress(storedState.ingress), staticGlobalIP) {
+		t.Errorf("Mutation of the returned ingress leaked into the collector")
+	}
+	if !hasFeature(featuresForServicePort(storedState.servicePorts[0]), cloudIAP) {
+		t.Errorf("Mutation of the returned backend config leaked into the collector")
+	}
+	if _, ok := newMetrics.GetIngressState("default/untracked"); ok {
+		t.Errorf("GetIngressState(default/untracked) found, want not found")
+	}
+}
+
+func TestIngressKeys(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for _, i := range []int{0, 1, 2} {
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[i].ing.Name), NewIngressState(ingressStates[i].ing, nil))
+	}
+	newMetrics.DeleteIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[1].ing.Name))
+
+	expectKeys := []string{"default/ingress0", "default/ingress2"}
+	if diff := cmp.Diff(expectKeys, newMetrics.IngressKeys()); diff != "" {
+		t.Errorf("Got diff for tracked ingress keys (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeBackendsWithoutConfig(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture port 2, the NEG default backend, has no BackendConfig while the
+	// other three fixture ports do.
+	newMetrics.SetIngress("default/external", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], testServicePorts[1]}))
+	newMetrics.SetIngress("default/internal", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[2], testServicePorts[3]}))
+	// A service port shared by another ingress is counted once.
+	newMetrics.SetIngress("default/shared", NewIngressState(ingressStates[3].ing, []utils.ServicePort{testServicePorts[2]}))
+
+	withoutConfig, withConfig := newMetrics.computeBackendsWithoutConfig()
+	if withoutConfig != 1 {
+		t.Errorf("Got %d service ports without a backend config, want 1", withoutConfig)
+	}
+	if withConfig != 3 {
+		t.Errorf("Got %d service ports with a backend config, want 3", withConfig)
+	}
+}
+
+func TestComputeImpliedBackendServices(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ports 0 and 2 share the same (service, port) pair while ports 1
+	// and 3 are distinct.
+	newMetrics.SetIngress("default/external", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], testServicePorts[1]}))
+	newMetrics.SetIngress("default/internal", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[2], testServicePorts[3]}))
+
+	if gotCount := newMetrics.computeImpliedBackendServices(); gotCount != 3 {
+		t.Errorf("Got %d implied backend services, want 3", gotCount)
+	}
+}
+
+func TestComputeServicePortProtocolCounts(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	httpsPort := testServicePorts[1]
+	httpsPort.Protocol = annotations.ProtocolHTTPS
+	http2Port := testServicePorts[2]
+	http2Port.Protocol = annotations.ProtocolHTTP2
+	// Fixture ports 0 and 3 carry no application protocol and resolve to HTTP.
+	newMetrics.SetIngress("default/external", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], httpsPort}))
+	newMetrics.SetIngress("default/internal", NewIngressState(ingressStates[2].ing, []utils.ServicePort{http2Port, testServicePorts[3]}))
+	// A service port shared by another ingress is counted once.
+	newMetrics.SetIngress("default/shared", NewIngressState(ingressStates[1].ing, []utils.ServicePort{httpsPort}))
+
+	expectCounts := map[string]int{
+		"HTTP":  2,
+		"HTTPS": 1,
+		"HTTP2": 1,
+	}
+	if diff := cmp.Diff(expectCounts, newMetrics.computeServicePortProtocolCounts()); diff != "" {
+		t.Errorf("Got diff for service port protocol counts (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeAverageBackendsPerIngress(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	if gotAverage := newMetrics.computeAverageBackendsPerIngress(); gotAverage != 0 {
+		t.Errorf("Got an average of %v backends per ingress without ingresses, want 0", gotAverage)
+	}
+	newMetrics.SetIngress("default/no-backends", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.SetIngress("default/one-backend", NewIngressState(ingressStates[1].ing, []utils.ServicePort{testServicePorts[0]}))
+	newMetrics.SetIngress("default/two-backends", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[1], testServicePorts[2]}))
+
+	if gotAverage := newMetrics.computeAverageBackendsPerIngress(); gotAverage != 1 {
+		t.Errorf("Got an average of %v backends per ingress, want 1", gotAverage)
+	}
+}
+
+func TestComputeFeatureErrorRates(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture port 0 enables Cloud CDN and port 1 does not.
+	newMetrics.SetIngress("default/cdn-ingress", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0]}))
+	newMetrics.SetIngress("default/plain-ingress", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[1]}))
+	newMetrics.RecordIngressError("default/cdn-ingress")
+
+	errorRates := newMetrics.computeFeatureErrorRates()
+	if gotRate := errorRates[cloudCDN]; gotRate != 1 {
+		t.Errorf("Got error rate %f for feature %s, want 1", gotRate, cloudCDN)
+	}
+	if gotRate := errorRates[cloudIAP]; gotRate != 0 {
+		t.Errorf("Got error rate %f for feature %s, want 0", gotRate, cloudIAP)
+	}
+	if gotRate := errorRates[ingress]; gotRate != 0.5 {
+		t.Errorf("Got error rate %f for feature %s, want 0.5", gotRate, ingress)
+	}
+}
+
+func TestIngressTimeout(t *testing.T) {
+	t.Parallel()
+	timeoutIng := ingressStates[0].ing.DeepCopy()
+	timeoutIng.Annotations = map[string]string{ingressTimeoutKey: "30s"}
+	if !hasFeature(featuresForIngress(timeoutIng), ingressTimeout) {
+		t.Errorf("Expected feature %s for ingress with the %s annotation", ingressTimeout, ingressTimeoutKey)
+	}
+	if hasFeature(featuresForIngress(ingressStates[0].ing), ingressTimeout) {
+		t.Errorf("Unexpected feature %s for ingress without the %s annotation", ingressTimeout, ingressTimeoutKey)
+	}
+}
+
+func TestWildcardManagedCert(t *testing.T) {
+	t.Parallel()
+	wildcardIng := ingressStates[0].ing.DeepCopy()
+	wildcardIng.Annotations = map[string]string{managedCertKey: "managed-cert1,*.example.com"}
+	if !hasFeature(featuresForIngress(wildcardIng), wildcardManagedCert) {
+		t.Errorf("Expected feature %s for ingress with a wildcard managed cert", wildcardManagedCert)
+	}
+	plainIng := ingressStates[0].ing.DeepCopy()
+	plainIng.Annotations = map[string]string{managedCertKey: "managed-cert1"}
+	if hasFeature(featuresForIngress(plainIng), wildcardManagedCert) {
+		t.Errorf("Unexpected feature %s for ingress without a wildcard managed cert", wildcardManagedCert)
+	}
+}
+
+func TestExplicitNoAffinity(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 configures cookie based affinity.
+	noAffinityPort := testServicePorts[0]
+	noAffinityPort.BackendConfig = noAffinityPort.BackendConfig.DeepCopy()
+	noAffinityPort.BackendConfig.Spec.SessionAffinity.AffinityType = "NONE"
+	if !hasFeature(featuresForServicePort(noAffinityPort), explicitNoAffinity) {
+		t.Errorf("Expected feature %s for service port with affinity type NONE", explicitNoAffinity)
+	}
+	// A service port without a session affinity config leaves the choice to
+	// the default and is not reported.
+	unsetPort := testServicePorts[0]
+	unsetPort.BackendConfig = unsetPort.BackendConfig.DeepCopy()
+	unsetPort.BackendConfig.Spec.SessionAffinity = nil
+	if hasFeature(featuresForServicePort(unsetPort), explicitNoAffinity) {
+		t.Errorf("Unexpected feature %s for service port without a session affinity config", explicitNoAffinity)
+	}
+}
+
+func TestGeneratedCookieAffinity(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 configures GENERATED_COOKIE affinity, which is reported
+	// under the generic cookie feature as well as the deprecated type.
+	gotFeatures := featuresForServicePort(testServicePorts[0])
+	if !hasFeature(gotFeatures, generatedCookieAffinity) {
+		t.Errorf("Expected feature %s for service port with GENERATED_COOKIE affinity", generatedCookieAffinity)
+	}
+	if !hasFeature(gotFeatures, cookieAffinity) {
+		t.Errorf("Expected feature %s alongside %s", cookieAffinity, generatedCookieAffinity)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[1]), generatedCookieAffinity) {
+		t.Errorf("Unexpected feature %s for service port with CLIENT_IP affinity", generatedCookieAffinity)
+	}
+}
+
+func TestCdnBypassHeaders(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 enables Cloud CDN without cache bypass headers.
+	bypassPort := testServicePorts[0]
+	bypassPort.BackendConfig = bypassPort.BackendConfig.DeepCopy()
+	bypassPort.BackendConfig.Spec.Cdn.BypassCacheOnRequestHeaders = []*backendconfigv1.BypassCacheOnRequestHeader{
+		{HeaderName: "Pragma"},
+	}
+	gotFeatures := featuresForServicePort(bypassPort)
+	if !hasFeature(gotFeatures, cdnBypassHeaders) {
+		t.Errorf("Expected feature %s for service port with cache bypass headers", cdnBypassHeaders)
+	}
+	if !hasFeature(gotFeatures, cloudCDN) {
+		t.Errorf("Expected feature %s for service port with cache bypass headers", cloudCDN)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[0]), cdnBypassHeaders) {
+		t.Errorf("Unexpected feature %s for service port without cache bypass headers", cdnBypassHeaders)
+	}
+}
+
+func TestCdnServeWhileStale(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 enables Cloud CDN without serve while stale.
+	stalePort := testServicePorts[0]
+	stalePort.BackendConfig = stalePort.BackendConfig.DeepCopy()
+	stalePort.BackendConfig.Spec.Cdn.ServeWhileStale = 86400
+	gotFeatures := featuresForServicePort(stalePort)
+	if !hasFeature(gotFeatures, cdnServeWhileStale) {
+		t.Errorf("Expected feature %s for service port with serve while stale", cdnServeWhileStale)
+	}
+	if !hasFeature(gotFeatures, cloudCDN) {
+		t.Errorf("Expected feature %s for service port with serve while stale", cloudCDN)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[0]), cdnServeWhileStale) {
+		t.Errorf("Unexpected feature %s for service port without serve while stale", cdnServeWhileStale)
+	}
+}
+
+func TestCdnWithIap(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 enables Cloud CDN without IAP, fixture port 1 the
+	// other way around.
+	cachedIapPort := testServicePorts[0]
+	cachedIapPort.BackendConfig = cachedIapPort.BackendConfig.DeepCopy()
+	cachedIapPort.BackendConfig.Spec.Iap = &backendconfigv1.IAPConfig{Enabled: true}
+	if !hasFeature(featuresForServicePort(cachedIapPort), cdnWithIap) {
+		t.Errorf("Expected feature %s for service port with both Cloud CDN and Cloud IAP", cdnWithIap)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[0]), cdnWithIap) {
+		t.Errorf("Unexpected feature %s for service port with Cloud CDN only", cdnWithIap)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[1]), cdnWithIap) {
+		t.Errorf("Unexpected feature %s for service port with Cloud IAP only", cdnWithIap)
+	}
+}
+
+func TestCapacityOverride(t *testing.T) {
+	t.Parallel()
+	overridePort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "capped-service",
+				Namespace: defaultNamespace,
+			},
+			Port: intstr.FromInt(80),
+		},
+		BackendConfig: &backendconfigv1.BackendConfig{
+			ObjectMeta: v1.ObjectMeta{
+				Annotations: map[string]string{maxRatePerEndpointKey: "100"},
+			},
+		},
+	}
+	if !hasFeature(featuresForServicePort(overridePort), capacityOverride) {
+		t.Errorf("Expected feature %s for service port with the %s annotation", capacityOverride, maxRatePerEndpointKey)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[0]), capacityOverride) {
+		t.Errorf("Unexpected feature %s for service port without capacity annotations", capacityOverride)
+	}
+}
+
+func TestDuplicatePreSharedCerts(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		certs         string
+		expectFeature bool
+	}{
+		{"duplicate cert names", "cert-a,cert-b,cert-a", true},
+		{"distinct cert names", "cert-a,cert-b", false},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			ing := ingressStates[0].ing.DeepCopy()
+			ing.Annotations = map[string]string{preSharedCertKey: tc.certs}
+			if gotFeature := hasFeature(featuresForIngress(ing), duplicatePreSharedCerts); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t for certs %q, want %t", duplicatePreSharedCerts, gotFeature, tc.certs, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestNegCustomPortName(t *testing.T) {
+	t.Parallel()
+	customNamePort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{
+				Name:      "neg-service",
+				Namespace: defaultNamespace,
+			},
+			Port: intstr.FromString("web"),
+		},
+		TargetPort: "8080",
+		NEGEnabled: true,
+	}
+	if !hasFeature(featuresForServicePort(customNamePort), negCustomPortName) {
+		t.Errorf("Expected feature %s for NEG-backed service port with a custom port name", negCustomPortName)
+	}
+	// A numeric service port reference does not involve port names.
+	if hasFeature(featuresForServicePort(testServicePorts[1]), negCustomPortName) {
+		t.Errorf("Unexpected feature %s for NEG-backed service port referenced by number", negCustomPortName)
+	}
+}
+
+func TestNegPortMismatch(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		svcPort       utils.ServicePort
+		expectFeature bool
+	}{
+		{
+			"named port without a resolved target port",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromString("metrics"),
+				},
+				NEGEnabled: true,
+			},
+			true,
+		},
+		{
+			"named port with a resolved target port",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromString("metrics"),
+				},
+				NEGEnabled: true,
+				TargetPort: "9090",
+			},
+			false,
+		},
+		{
+			"numeric port",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "neg-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				NEGEnabled: true,
+			},
+			false,
+		},
+		{
+			"unresolved named port without NEG",
+			utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "vm-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromString("metrics"),
+				},
+			},
+			false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if gotFeature := hasFeature(featuresForServicePort(tc.svcPort), negPortMismatch); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", negPortMismatch, gotFeature, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestEmptyExplicitRules(t *testing.T) {
+	t.Parallel()
+	// Fixture ingress0 has no rules at all while ingress2 carries an
+	// explicitly empty rules list.
+	if hasFeature(featuresForIngress(ingressStates[0].ing), emptyExplicitRules) {
+		t.Errorf("Unexpected feature %s for ingress with nil rules", emptyExplicitRules)
+	}
+	if !hasFeature(featuresForIngress(ingressStates[2].ing), emptyExplicitRules) {
+		t.Errorf("Expected feature %s for ingress with explicitly empty rules", emptyExplicitRules)
+	}
+}
+
+func TestConflictingManagedCertScope(t *testing.T) {
+	t.Parallel()
+	ing := &v1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "conflicting-certs-ingress",
+			Annotations: map[string]string{
+				managedCertKey:         "managed-cert1",
+				regionalManagedCertKey: "regional-managed-cert1",
+			},
+		},
+	}
+	gotFeatures := featuresForIngress(ing)
+	for _, ftr := range []feature{managedCertsForTLS, regionalManagedCertsForTLS, conflictingManagedCertScope, tlsTermination} {
+		if !hasFeature(gotFeatures, ftr) {
+			t.Errorf("Expected feature %s for ingress with both managed cert scopes", ftr)
+		}
+	}
+	// An ingress with only regional managed certs is not conflicting.
+	delete(ing.Annotations, managedCertKey)
+	gotFeatures = featuresForIngress(ing)
+	if !hasFeature(gotFeatures, regionalManagedCertsForTLS) {
+		t.Errorf("Expected feature %s for ingress with regional managed certs", regionalManagedCertsForTLS)
+	}
+	if hasFeature(gotFeatures, conflictingManagedCertScope) {
+		t.Errorf("Unexpected feature %s for ingress with a single managed cert scope", conflictingManagedCertScope)
+	}
+}
+
+func TestDrainingTimeoutClamped(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc               string
+		drainingTimeoutSec int64
+		expectFeature      bool
+	}{
+		{"timeout above the GCE maximum", 4000, true},
+		{"timeout within the GCE maximum", 60, false},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			svcPort := utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "draining-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						ConnectionDraining: &backendconfigv1.ConnectionDrainingConfig{
+							DrainingTimeoutSec: tc.drainingTimeoutSec,
+						},
+					},
+				},
+			}
+			if gotFeature := hasFeature(featuresForServicePort(svcPort), drainingTimeoutClamped); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t for draining timeout %d, want %t", drainingTimeoutClamped, gotFeature, tc.drainingTimeoutSec, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestInconsistentDrainTimeout(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc               string
+		timeoutSec         int64
+		drainingTimeoutSec int64
+		expectFeature      bool
+	}{
+		{"draining timeout exceeding the backend timeout", 30, 60, true},
+		{"draining timeout within the backend timeout", 60, 30, false},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			svcPort := utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "draining-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						TimeoutSec: &tc.timeoutSec,
+						ConnectionDraining: &backendconfigv1.ConnectionDrainingConfig{
+							DrainingTimeoutSec: tc.drainingTimeoutSec,
+						},
+					},
+				},
+			}
+			if gotFeature := hasFeature(featuresForServicePort(svcPort), inconsistentDrainTimeout); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t for draining timeout %d with backend timeout %d, want %t", inconsistentDrainTimeout, gotFeature, tc.drainingTimeoutSec, tc.timeoutSec, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestIgAffinity(t *testing.T) {
+	t.Parallel()
+	// Fixture port 0 configures cookie affinity on instance groups while
+	// fixture port 3 configures it on NEGs.
+	gotFeatures := featuresForServicePort(testServicePorts[0])
+	if !hasFeature(gotFeatures, igAffinity) {
+		t.Errorf("Expected feature %s for instance group service port with session affinity", igAffinity)
+	}
+	if !hasFeature(gotFeatures, cookieAffinity) {
+		t.Errorf("Expected feature %s to be kept alongside %s", cookieAffinity, igAffinity)
+	}
+	if hasFeature(featuresForServicePort(testServicePorts[3]), igAffinity) {
+		t.Errorf("Unexpected feature %s for NEG service port with session affinity", igAffinity)
+	}
+}
+
+func TestDrainingDisabled(t *testing.T) {
+	t.Parallel()
+	drainingServicePort := func(draining *backendconfigv1.ConnectionDrainingConfig) utils.ServicePort {
+		return utils.ServicePort{
+			ID: utils.ServicePortID{
+				Service: types.NamespacedName{
+					Name:      "draining-service",
+					Namespace: defaultNamespace,
+				},
+				Port: intstr.FromInt(80),
+			},
+			BackendConfig: &backendconfigv1.BackendConfig{
+				Spec: backendconfigv1.BackendConfigSpec{
+					ConnectionDraining: draining,
+				},
+			},
+		}
+	}
+	for _, tc := range []struct {
+		desc           string
+		draining       *backendconfigv1.ConnectionDrainingConfig
+		expectDraining bool
+		expectDisabled bool
+	}{
+		{
+			"draining timeout explicitly zero",
+			&backendconfigv1.ConnectionDrainingConfig{DrainingTimeoutSec: 0},
+			false,
+			true,
+		},
+		{
+			"draining unset",
+			nil,
+			false,
+			false,
+		},
+		{
+			"positive draining timeout",
+			&backendconfigv1.ConnectionDrainingConfig{DrainingTimeoutSec: testTTL},
+			true,
+			false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			gotFeatures := featuresForServicePort(drainingServicePort(tc.draining))
+			if gotFeature := hasFeature(gotFeatures, backendConnectionDraining); gotFeature != tc.expectDraining {
+				t.Errorf("Got feature %s = %t, want %t", backendConnectionDraining, gotFeature, tc.expectDraining)
+			}
+			if gotFeature := hasFeature(gotFeatures, drainingDisabled); gotFeature != tc.expectDisabled {
+				t.Errorf("Got feature %s = %t, want %t", drainingDisabled, gotFeature, tc.expectDisabled)
+			}
+		})
+	}
+}
+
+func TestTemplatedRequestHeaders(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		headers       []string
+		expectFeature bool
+	}{
+		{
+			"templated header value",
+			[]string{"X-Client-IP:{client_ip_address}"},
+			true,
+		},
+		{
+			"static header values",
+			[]string{"X-Env:prod", "X-Region:us-central1"},
+			false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			svcPort := utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "header-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(80),
+				},
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						CustomRequestHeaders: &backendconfigv1.CustomRequestHeadersConfig{
+							Headers: tc.headers,
+						},
+					},
+				},
+			}
+			gotFeatures := featuresForServicePort(svcPort)
+			if !hasFeature(gotFeatures, customRequestHeaders) {
+				t.Errorf("Expected feature %s for service port with custom request headers", customRequestHeaders)
+			}
+			if gotFeature := hasFeature(gotFeatures, templatedRequestHeaders); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", templatedRequestHeaders, gotFeature, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestClientCertHeaders(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		headers       []string
+		expectFeature bool
+	}{
+		{
+			"client certificate header value",
+			[]string{"X-Client-Cert-Present:{client_cert_present}"},
+			true,
+		},
+		{
+			"templated header without client certificate info",
+			[]string{"X-Client-IP:{client_ip_address}"},
+			false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			svcPort := utils.ServicePort{
+				ID: utils.ServicePortID{
+					Service: types.NamespacedName{
+						Name:      "mtls-service",
+						Namespace: defaultNamespace,
+					},
+					Port: intstr.FromInt(443),
+				},
+				BackendConfig: &backendconfigv1.BackendConfig{
+					Spec: backendconfigv1.BackendConfigSpec{
+						CustomRequestHeaders: &backendconfigv1.CustomRequestHeadersConfig{
+							Headers: tc.headers,
+						},
+					},
+				},
+			}
+			if gotFeature := hasFeature(featuresForServicePort(svcPort), clientCertHeaders); gotFeature != tc.expectFeature {
+				t.Errorf("Got feature %s = %t, want %t", clientCertHeaders, gotFeature, tc.expectFeature)
+			}
+		})
+	}
+}
+
+func TestIapWithoutTLS(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc        string
+		ingState    IngressState
+		expectCount int
+	}{
+		{
+			"IAP backend on http-only ingress",
+			NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts),
+			1,
+		},
+		{
+			"IAP backend on ingress with TLS termination",
+			NewIngressState(ingressStates[9].ing, ingressStates[9].svcPorts),
+			0,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			newMetrics := NewControllerMetrics()
+			ingKey := fmt.Sprintf("%s/%s", defaultNamespace, tc.ingState.ingress.Name)
+			newMetrics.SetIngress(ingKey, tc.ingState)
+			gotIngressCount, _ := newMetrics.computeIngressMetrics()
+			if gotIngressCount[iapWithoutTLS] != tc.expectCount {
+				t.Errorf("Got %d ingresses with %s, want %d", gotIngressCount[iapWithoutTLS], iapWithoutTLS, tc.expectCount)
+			}
+		})
+	}
+}
+
+func TestComputeIngressMetricsGroupedBy(t *testing.T) {
+	t.Parallel()
+	envKey := "env"
+	newMetrics := NewControllerMetrics()
+	for i, env := range map[int]string{0: "prod", 1: "prod", 3: "dev"} {
+		ing := ingressStates[i].ing.DeepCopy()
+		if ing.Annotations == nil {
+			ing.Annotations = make(map[string]string)
+		}
+		ing.Annotations[envKey] = env
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, ingressStates[i].svcPorts))
+	}
+
+	gotGrouped := newMetrics.computeIngressMetricsGroupedBy(func(ing *v1beta1.Ingress) string {
+		return ing.Annotations[envKey]
+	})
+	expectProdCount, _ := initializeCounts()
+	expectProdCount[ingress] = 2
+	expectProdCount[externalIngress] = 2
+	expectProdCount[httpEnabled] = 1
+	expectDevCount, _ := initializeCounts()
+	for _, ftr := range []feature{ingress, externalIngress, httpEnabled, hostBasedRouting} {
+		expectDevCount[ftr] = 1
+	}
+	expectGrouped := map[string]map[feature]int{"prod": expectProdCount, "dev": expectDevCount}
+	if diff := cmp.Diff(expectGrouped, gotGrouped); diff != "" {
+		t.Errorf("Got diff for grouped ingress features count (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeInternalIngressMetrics(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress11 is the only internal ingress.
+	for _, i := range []int{0, 4, 11} {
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[i].ing.Name), NewIngressState(ingressStates[i].ing, ingressStates[i].svcPorts))
+	}
+
+	expectIngressCount, _ := initializeCounts()
+	for _, ftr := range []feature{ingress, internalIngress, httpEnabled, hostBasedRouting,
+		pathBasedRouting, neg, negDefaultHealthCheck, cloudIAP, iapOpenAccess, cookieAffinity,
+		generatedCookieAffinity, backendConnectionDraining, iapWithoutTLS, numberedServicePort} {
+		expectIngressCount[ftr] = 1
+	}
+	if diff := cmp.Diff(expectIngressCount, newMetrics.computeInternalIngressMetrics()); diff != "" {
+		t.Errorf("Got diff for internal ingress features count (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeCloudArmorCoverage(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress5 has one armored and one unarmored port, ingress4 only
+	// an unarmored one and ingress0 no ports at all.
+	for _, i := range []int{0, 4, 5} {
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[i].ing.Name), NewIngressState(ingressStates[i].ing, ingressStates[i].svcPorts))
+	}
+
+	expectCoverage := map[string]float64{
+		"default/ingress4": 0,
+		"default/ingress5": 0.5,
+	}
+	if diff := cmp.Diff(expectCoverage, newMetrics.computeCloudArmorCoverage()); diff != "" {
+		t.Errorf("Got diff for cloud armor coverage (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeUniqueBackendServices(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixtures ingress4 and ingress9 both reference foo-service only, while
+	// ingress5 adds dummy-service.
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[4].ing.Name), NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts))
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[9].ing.Name), NewIngressState(ingressStates[9].ing, ingressStates[9].svcPorts))
+	if got := newMetrics.computeUniqueBackendServices(); got != 1 {
+		t.Errorf("Got %d unique backend services, want 1", got)
+	}
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[5].ing.Name), NewIngressState(ingressStates[5].ing, ingressStates[5].svcPorts))
+	if got := newMetrics.computeUniqueBackendServices(); got != 2 {
+		t.Errorf("Got %d unique backend services, want 2", got)
+	}
+}
+
+func TestComputeIngressMetricsFiltered(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetIngress(fmt.Sprintf("team-a/%s", ingressStates[4].ing.Name), NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts))
+	newMetrics.SetIngress(fmt.Sprintf("team-b/%s", ingressStates[2].ing.Name), NewIngressState(ingressStates[2].ing, ingressStates[2].svcPorts))
+
+	expectIngressCount, _ := initializeCounts()
+	for _, ftr := range []feature{ingress, externalIngress, httpEnabled, hostBasedRouting,
+		pathBasedRouting, neg, negDefaultHealthCheck, cloudIAP, iapOpenAccess, clientIPAffinity,
+		backendTimeout, customRequestHeaders, iapWithoutTLS, numberedServicePort} {
+		expectIngressCount[ftr] = 1
+	}
+	gotIngressCount := newMetrics.computeIngressMetricsFiltered(func(ingKey string) bool {
+		return strings.HasPrefix(ingKey, "team-a/")
+	})
+	if diff := cmp.Diff(expectIngressCount, gotIngressCount); diff != "" {
+		t.Errorf("Got diff for filtered ingress features count (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeIngressMetricsExcluding(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for _, i := range []int{0, 3} {
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[i].ing.Name), NewIngressState(ingressStates[i].ing, ingressStates[i].svcPorts))
+	}
+
+	// Excluding ingress3 leaves only ingress0, dropping its host based
+	// routing from the counts.
+	expectIngressCount, _ := initializeCounts()
+	for _, ftr := range []feature{ingress, externalIngress, httpEnabled} {
+		expectIngressCount[ftr] = 1
+	}
+	excludedKeys := map[string]bool{fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[3].ing.Name): true}
+	if diff := cmp.Diff(expectIngressCount, newMetrics.computeIngressMetricsExcluding(excludedKeys)); diff != "" {
+		t.Errorf("Got diff for ingress features count excluding %v (-want +got):\n%s", excludedKeys, diff)
+	}
+}
+
+func TestComputeIngressMetricsWhere(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Only ingress9 terminates TLS; ingress0 must not contribute any counts.
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[9].ing.Name), NewIngressState(ingressStates[9].ing, ingressStates[9].svcPorts))
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[0].ing.Name), NewIngressState(ingressStates[0].ing, ingressStates[0].svcPorts))
+
+	expectIngressCount, _ := initializeCounts()
+	for _, ftr := range []feature{ingress, externalIngress, httpEnabled, hostBasedRouting,
+		pathBasedRouting, preSharedCertsForTLS, secretBasedCertsForTLS, tlsTermination,
+		dualProtocol, neg, negDefaultHealthCheck, cloudIAP, iapOpenAccess, clientIPAffinity,
+		backendTimeout, customRequestHeaders, numberedServicePort} {
+		expectIngressCount[ftr] = 1
+	}
+	if diff := cmp.Diff(expectIngressCount, newMetrics.computeIngressMetricsWhere(tlsTermination)); diff != "" {
+		t.Errorf("Got diff for ingress features count with filter %s (-want +got):\n%s", tlsTermination, diff)
+	}
+}
+
+func TestTrafficSplitting(t *testing.T) {
+	t.Parallel()
+	ing := &v1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "split-ingress",
+			Annotations: map[string]string{
+				trafficSplitKey: "foo-service=80,bar-service=20",
+			},
+		},
+	}
+	gotFeatures := featuresForIngress(ing)
+	if !hasFeature(gotFeatures, trafficSplitting) {
+		t.Errorf("Expected feature %s for ingress with annotation %s", trafficSplitting, trafficSplitKey)
+	}
+	if hasFeature(featuresForIngress(ingressStates[0].ing), trafficSplitting) {
+		t.Errorf("Unexpected feature %s for ingress without annotation %s", trafficSplitting, trafficSplitKey)
+	}
+}
+
+func TestComputePreSharedCertFanout(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, certs := range []string{"cert-a,cert-b", "cert-a"} {
+		ing := &v1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: defaultNamespace,
+				Name:      fmt.Sprintf("cert-ingress%d", i),
+				Annotations: map[string]string{
+					preSharedCertKey: certs,
+				},
+			},
+		}
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, nil))
+	}
+	// An ingress without the annotation does not contribute to the fanout.
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[0].ing.Name), NewIngressState(ingressStates[0].ing, nil))
+
+	expectFanout := map[string]int{
+		"cert-a": 2,
+		"cert-b": 1,
+	}
+	if diff := cmp.Diff(expectFanout, newMetrics.computePreSharedCertFanout()); diff != "" {
+		t.Errorf("Got diff for pre-shared cert fanout (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeStaticIPFanout(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, ip := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+		ing := &v1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: defaultNamespace,
+				Name:      fmt.Sprintf("static-ip-ingress%d", i),
+				Annotations: map[string]string{
+					staticIPKey: ip,
+				},
+			},
+		}
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, nil))
+	}
+	// An ingress without the annotation does not contribute to the fanout.
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[0].ing.Name), NewIngressState(ingressStates[0].ing, nil))
+
+	expectFanout := map[string]int{
+		"10.0.0.1": 2,
+		"10.0.0.2": 1,
+	}
+	if diff := cmp.Diff(expectFanout, newMetrics.computeStaticIPFanout()); diff != "" {
+		t.Errorf("Got diff for static ip fanout (-want +got):\n%s", diff)
+	}
+	// Both ingresses sharing 10.0.0.1 report the conflict.
+	if got := newMetrics.computeStaticIPConflicts(); got != 2 {
+		t.Errorf("Got %d ingresses with feature %s, want 2", got, staticIPConflict)
+	}
+	ingCount, _ := newMetrics.computeIngressMetrics()
+	if gotCount := ingCount[staticIPConflict]; gotCount != 2 {
+		t.Errorf("Got %d ingresses with feature %s in ingress metrics, want 2", gotCount, staticIPConflict)
+	}
+}
+
+func TestComputeIngressesByApiVersion(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	v1State := NewIngressState(ingressStates[0].ing, nil)
+	v1State.SetAPIVersion("v1")
+	newMetrics.SetIngress("default/v1-ingress", v1State)
+	v1beta1State := NewIngressState(ingressStates[1].ing, nil)
+	v1beta1State.SetAPIVersion("v1beta1")
+	newMetrics.SetIngress("default/v1beta1-ingress", v1beta1State)
+	// An untagged ingress state counts as v1beta1.
+	newMetrics.SetIngress("default/untagged-ingress", NewIngressState(ingressStates[2].ing, nil))
+
+	expectCounts := map[string]int{
+		"v1":      1,
+		"v1beta1": 2,
+	}
+	if diff := cmp.Diff(expectCounts, newMetrics.computeIngressesByApiVersion()); diff != "" {
+		t.Errorf("Got diff for ingress counts by API version (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeSharedBackendGroups(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture port 1 backs two ingresses while port 3 backs only one.
+	newMetrics.SetIngress("default/shared1", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[1]}))
+	newMetrics.SetIngress("default/shared2", NewIngressState(ingressStates[1].ing, []utils.ServicePort{testServicePorts[1]}))
+	newMetrics.SetIngress("default/exclusive", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[3]}))
+
+	expectGroups := map[string][]string{
+		testServicePorts[1].ID.String(): {"default/shared1", "default/shared2"},
+	}
+	if diff := cmp.Diff(expectGroups, newMetrics.computeSharedBackendGroups()); diff != "" {
+		t.Errorf("Got diff for shared backend groups (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeSecurityPolicyFanout(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture port 0 references "security-policy-1" on both ingresses; a
+	// service port without a security policy does not contribute.
+	newMetrics.SetIngress("default/armor-ingress1", NewIngressState(ingressStates[0].ing, []utils.ServicePort{testServicePorts[0], testServicePorts[1]}))
+	newMetrics.SetIngress("default/armor-ingress2", NewIngressState(ingressStates[1].ing, []utils.ServicePort{testServicePorts[0]}))
+
+	expectFanout := map[string]int{
+		"security-policy-1": 2,
+	}
+	if diff := cmp.Diff(expectFanout, newMetrics.computeSecurityPolicyFanout()); diff != "" {
+		t.Errorf("Got diff for security policy fanout (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeUniformBackendConfigIngresses(t *testing.T) {
+	t.Parallel()
+	configPort := func(configName string) utils.ServicePort {
+		return utils.ServicePort{
+			BackendConfig: &backendconfigv1.BackendConfig{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: defaultNamespace,
+					Name:      configName,
+				},
+			},
+		}
+	}
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetIngress("default/uniform-ingress", NewIngressState(ingressStates[0].ing, []utils.ServicePort{configPort("shared-config"), configPort("shared-config")}))
+	newMetrics.SetIngress("default/mixed-ingress", NewIngressState(ingressStates[1].ing, []utils.ServicePort{configPort("shared-config"), configPort("other-config")}))
+	// An ingress without any configured service port is not counted.
+	newMetrics.SetIngress("default/no-config-ingress", NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[2]}))
+
+	if gotCount := newMetrics.computeUniformBackendConfigIngresses(); gotCount != 1 {
+		t.Errorf("Got %d uniform BackendConfig ingresses, want 1", gotCount)
+	}
+}
+
+func TestComputeIngressesWithNoBackends(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress4 references a rule path backend but no service port
+	// resolved for it.
+	newMetrics.SetIngress("default/no-backends", NewIngressState(ingressStates[4].ing, nil))
+	// A truly empty spec has no backends to resolve.
+	newMetrics.SetIngress("default/empty-spec", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.SetIngress("default/resolved-backends", NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts))
+
+	if gotCount := newMetrics.computeIngressesWithNoBackends(); gotCount != 1 {
+		t.Errorf("Got %d ingresses without backends, want 1", gotCount)
+	}
+}
+
+func TestComputeManagedCertCountHistogram(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, certList := range []string{"", "cert1", "cert1, cert2, cert3", "c1,c2,c3,c4,c5,c6"} {
+		ing := ingressStates[0].ing.DeepCopy()
+		ing.Name = fmt.Sprintf("cert-ingress%d", i)
+		if certList != "" {
+			ing.Annotations = map[string]string{managedCertKey: certList}
+		}
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, nil))
+	}
+
+	expectHistogram := map[string]int{
+		"0":   1,
+		"1":   1,
+		"2-5": 1,
+		"6+":  1,
+	}
+	if diff := cmp.Diff(expectHistogram, newMetrics.computeManagedCertCountHistogram()); diff != "" {
+		t.Errorf("Got diff for managed cert count histogram (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeatureFirstSeen(t *testing.T) {
+	t.Parallel()
+	fakeClock := clock.NewFakeClock(time.Now())
+	newMetrics := NewControllerMetrics()
+	newMetrics.clock = fakeClock
+
+	if _, ok := newMetrics.FeatureFirstSeen(neg); ok {
+		t.Errorf("FeatureFirstSeen(%s) = true before any observation, want false", neg)
+	}
+	newMetrics.SetIngress("default/ingress-neg", NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts))
+	firstSeen, ok := newMetrics.FeatureFirstSeen(neg)
+	if !ok {
+		t.Fatalf("FeatureFirstSeen(%s) = false after observation, want true", neg)
+	}
+	if !firstSeen.Equal(fakeClock.Now()) {
+		t.Errorf("FeatureFirstSeen(%s) = %v, want %v", neg, firstSeen, fakeClock.Now())
+	}
+	// Subsequent observations must not overwrite the first-seen time.
+	fakeClock.Step(5 * time.Minute)
+	newMetrics.SetIngress("default/ingress-neg2", NewIngressState(ingressStates[9].ing, ingressStates[9].svcPorts))
+	laterSeen, ok := newMetrics.FeatureFirstSeen(neg)
+	if !ok {
+		t.Fatalf("FeatureFirstSeen(%s) = false after second observation, want true", neg)
+	}
+	if !laterSeen.Equal(firstSeen) {
+		t.Errorf("FeatureFirstSeen(%s) = %v after second observation, want %v", neg, laterSeen, firstSeen)
+	}
+}
+
+func TestOldestIngressStateAge(t *testing.T) {
+	t.Parallel()
+	fakeClock := clock.NewFakeClock(time.Now())
+	newMetrics := NewControllerMetrics()
+	newMetrics.clock = fakeClock
+
+	if gotAge := newMetrics.OldestIngressStateAge(); gotAge != 0 {
+		t.Errorf("OldestIngressStateAge() = %v for empty state, want 0", gotAge)
+	}
+	newMetrics.SetIngress("default/ingress-old", NewIngressState(ingressStates[0].ing, nil))
+	fakeClock.Step(5 * time.Minute)
+	newMetrics.SetIngress("default/ingress-new", NewIngressState(ingressStates[1].ing, nil))
+	fakeClock.Step(2 * time.Minute)
+	if gotAge := newMetrics.OldestIngressStateAge(); gotAge != 7*time.Minute {
+		t.Errorf("OldestIngressStateAge() = %v, want %v", gotAge, 7*time.Minute)
+	}
+	// Deleting the oldest entry moves the oldest age forward.
+	newMetrics.DeleteIngress("default/ingress-old")
+	if gotAge := newMetrics.OldestIngressStateAge(); gotAge != 2*time.Minute {
+		t.Errorf("OldestIngressStateAge() = %v after delete, want %v", gotAge, 2*time.Minute)
+	}
+	// Re-setting an entry refreshes its timestamp.
+	newMetrics.SetIngress("default/ingress-new", NewIngressState(ingressStates[1].ing, nil))
+	if gotAge := newMetrics.OldestIngressStateAge(); gotAge != 0 {
+		t.Errorf("OldestIngressStateAge() = %v after update, want 0", gotAge)
+	}
+}
+
+func TestFeatureGaps(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetIngress("default/ingress2", NewIngressState(ingressStates[2].ing, ingressStates[2].svcPorts))
+	newMetrics.SetIngress("default/ingress4", NewIngressState(ingressStates[4].ing, ingressStates[4].svcPorts))
+	// An ingress in another namespace does not contribute to the gaps.
+	otherNamespaceIng := &v1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "other",
+			Name:      "static-ip-ingress",
+			Annotations: map[string]string{
+				staticIPKey: "10.0.1.2",
+			},
+		},
+	}
+	newMetrics.SetIngress("other/static-ip-ingress", NewIngressState(otherNamespaceIng, nil))
+
+	expectGaps := []feature{backendConnectionDraining, cloudArmor, cloudCDN, cookieAffinity, emptyExplicitRules, generatedCookieAffinity, igAffinity}
+	if diff := cmp.Diff(expectGaps, newMetrics.FeatureGaps("default/ingress4")); diff != "" {
+		t.Errorf("Got diff for feature gaps (-want +got):\n%s", diff)
+	}
+	if gotGaps := newMetrics.FeatureGaps("default/untracked"); gotGaps != nil {
+		t.Errorf("FeatureGaps(untracked) = %v, want nil", gotGaps)
+	}
+}
+
+func TestComputeFrontendConfigFanout(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, feConfig := range []string{"fe-config1", "fe-config1", "fe-config2"} {
+		ing := &v1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: defaultNamespace,
+				Name:      fmt.Sprintf("fe-ingress%d", i),
+				Annotations: map[string]string{
+					frontendConfigKey: feConfig,
+				},
+			},
+		}
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, nil))
+	}
+	newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[0].ing.Name), NewIngressState(ingressStates[0].ing, nil))
+
+	expectFanout := map[string]int{
+		"fe-config1": 2,
+		"fe-config2": 1,
+	}
+	if diff := cmp.Diff(expectFanout, newMetrics.computeFrontendConfigFanout()); diff != "" {
+		t.Errorf("Got diff for FrontendConfig fanout (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeNegAdoptionRatio(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc          string
+		ingressStates []IngressState
+		expectRatio   float64
+	}{
+		{
+			"no service ports",
+			[]IngressState{
+				NewIngressState(ingressStates[0].ing, nil),
+			},
+			0,
+		},
+		{
+			"all ports on instance groups",
+			[]IngressState{
+				NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[0]}),
+			},
+			0,
+		},
+		{
+			"all ports on NEGs",
+			[]IngressState{
+				NewIngressState(ingressStates[4].ing, []utils.ServicePort{testServicePorts[1]}),
+				NewIngressState(ingressStates[11].ing, []utils.ServicePort{testServicePorts[2], testServicePorts[3]}),
+			},
+			1,
+		},
+		{
+			"mixed NEG and instance group ports",
+			[]IngressState{
+				NewIngressState(ingressStates[2].ing, []utils.ServicePort{testServicePorts[0]}),
+				NewIngressState(ingressStates[4].ing, []utils.ServicePort{testServicePorts[1]}),
+				NewIngressState(ingressStates[11].ing, []utils.ServicePort{testServicePorts[2], testServicePorts[3]}),
+			},
+			0.75,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			newMetrics := NewControllerMetrics()
+			for _, ingState := range tc.ingressStates {
+				ingKey := fmt.Sprintf("%s/%s", defaultNamespace, ingState.ingress.Name)
+				newMetrics.SetIngress(ingKey, ingState)
+			}
+			if gotRatio := newMetrics.computeNegAdoptionRatio(); gotRatio != tc.expectRatio {
+				t.Errorf("computeNegAdoptionRatio() = %v, want %v", gotRatio, tc.expectRatio)
+			}
+		})
+	}
+}
+
+func TestComputePathMatcherCountHistogram(t *testing.T) {
+	t.Parallel()
+	multiHostIngress := func(name string, hostCount int) *v1beta1.Ingress {
+		var rules []v1beta1.IngressRule
+		for i := 0; i < hostCount; i++ {
+			rules = append(rules, v1beta1.IngressRule{Host: fmt.Sprintf("host%d.example.com", i)})
+		}
+		return &v1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: defaultNamespace,
+				Name:      name,
+			},
+			Spec: v1beta1.IngressSpec{Rules: rules},
+		}
+	}
+	newMetrics := NewControllerMetrics()
+	// No hosts at all, a single host specified twice, three hosts and a
+	// host count above the URL map limit.
+	newMetrics.SetIngress("default/no-hosts", NewIngressState(ingressStates[0].ing, nil))
+	duplicateHosts := multiHostIngress("duplicate-hosts", 1)
+	duplicateHosts.Spec.Rules = append(duplicateHosts.Spec.Rules, v1beta1.IngressRule{Host: "host0.example.com"})
+	newMetrics.SetIngress("default/duplicate-hosts", NewIngressState(duplicateHosts, nil))
+	newMetrics.SetIngress("default/three-hosts", NewIngressState(multiHostIngress("three-hosts", 3), nil))
+	newMetrics.SetIngress("default/many-hosts", NewIngressState(multiHostIngress("many-hosts", urlMapPathMatcherLimit), nil))
+
+	expectHistogram := map[string]int{
+		"1":     1,
+		"2-10":  2,
+		"11-50": 0,
+		"51+":   1,
+	}
+	if diff := cmp.Diff(expectHistogram, newMetrics.computePathMatcherCountHistogram()); diff != "" {
+		t.Errorf("Got diff for path matcher count histogram (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeAnnotationCountHistogram(t *testing.T) {
+	t.Parallel()
+	annotatedIngress := func(name string, annotationCount int) *v1beta1.Ingress {
+		ingAnnotations := make(map[string]string, annotationCount)
+		for i := 0; i < annotationCount; i++ {
+			ingAnnotations[fmt.Sprintf("example.com/annotation%d", i)] = "value"
+		}
+		return &v1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace:   defaultNamespace,
+				Name:        name,
+				Annotations: ingAnnotations,
+			},
+		}
+	}
+	newMetrics := NewControllerMetrics()
+	for _, annotationCount := range []int{0, 2, 4, 6, 12} {
+		ing := annotatedIngress(fmt.Sprintf("annotated-ingress%d", annotationCount), annotationCount)
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ing.Name), NewIngressState(ing, nil))
+	}
+
+	expectHistogram := map[string]int{
+		"0-2":  2,
+		"3-5":  1,
+		"6-10": 1,
+		"11+":  1,
+	}
+	if diff := cmp.Diff(expectHistogram, newMetrics.computeAnnotationCountHistogram()); diff != "" {
+		t.Errorf("Got diff for annotation count histogram (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeSingleHostIngresses(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixture ingress4 serves the single host foo.bar while ingress0 has no
+	// rules and hence no distinct host.
+	newMetrics.SetIngress("default/single-host", NewIngressState(ingressStates[4].ing, nil))
+	newMetrics.SetIngress("default/no-hosts", NewIngressState(ingressStates[0].ing, nil))
+	multiHostIng := ingressStates[4].ing.DeepCopy()
+	multiHostIng.Spec.Rules = append(multiHostIng.Spec.Rules, v1beta1.IngressRule{Host: "bar.baz"})
+	newMetrics.SetIngress("default/multi-host", NewIngressState(multiHostIng, nil))
+
+	if gotCount := newMetrics.computeSingleHostIngresses(); gotCount != 1 {
+		t.Errorf("Got %d single host ingresses, want 1", gotCount)
+	}
+}
+
+func TestComputeDistinctHosts(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	// Fixtures ingress3 and ingress4 both serve foo.bar, ingress11 adds the
+	// host bar and ingress0 has no rules at all.
+	for _, i := range []int{0, 3, 4, 11} {
+		newMetrics.SetIngress(fmt.Sprintf("%s/%s", defaultNamespace, ingressStates[i].ing.Name), NewIngressState(ingressStates[i].ing, nil))
+	}
+
+	if gotCount := newMetrics.computeDistinctHosts(); gotCount != 2 {
+		t.Errorf("Got %d distinct hosts, want 2", gotCount)
+	}
+}
+
+func TestComputeNegMetrics(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		desc           string
+		negStates      []NegServiceState
+		expectNegCount map[feature]int
+	}{
+		{
+			"empty input",
+			[]NegServiceState{},
+			map[feature]int{
+				standaloneNeg:    0,
+				ingressNeg:       0,
+				asmNeg:           0,
+				neg:              0,
+				negReadinessGate: 0,
+				asmNegSubsetting: 0,
+			},
+		},
+		{
+			"one neg service",
+			[]NegServiceState{
+				newNegState(0, 0, 1),
+			},
+			map[feature]int{
+				standaloneNeg:    0,
+				ingressNeg:       0,
+				asmNeg:           1,
+				neg:              1,
+				negReadinessGate: 0,
+				asmNegSubsetting: 0,
+			},
+		},
+		{
+			"many neg services",
+			[]NegServiceState{
+				newNegState(0, 0, 1),
+				newNegState(0, 1, 0),
+				newNegState(5, 0, 0),
+				newNegState(5, 3, 2),
+			},
+			map[feature]int{
+				standaloneNeg:    10,
+				ingressNeg:       4,
+				asmNeg:           3,
+				neg:              17,
+				negReadinessGate: 0,
+				asmNegSubsetting: 0,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			newMetrics := NewControllerMetrics()
+			for i, negState := range tc.negStates {
+				newMetrics.SetNegService(fmt.Sprint(i), negState)
+			}
+			output := newMetrics.computeNegMetrics()
+			if !reflect.DeepEqual(output, tc.expectNegCount) {
+				t.Errorf("For case %q, expect output %v, but got %v", tc.desc, tc.expectNegCount, output)
+			}
+		})
+	}
+}
+
+func TestNegCountChanges(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetNegService("service-1", newNegState(1, 2, 0))
+	// The first observation of a service is not a change.
+	if len(newMetrics.negCountChanges) != 0 {
+		t.Errorf("Got %d neg count changes for new service, want 0", len(newMetrics.negCountChanges))
+	}
+	newMetrics.SetNegService("service-1", newNegState(3, 2, 0))
+	expectChanges := map[feature]int{standaloneNeg: 1}
+	if diff := cmp.Diff(expectChanges, newMetrics.negCountChanges); diff != "" {
+		t.Errorf("Got diff for neg count changes (-want +got):\n%s", diff)
+	}
+	// An update with identical counts is not a change either.
+	newMetrics.SetNegService("service-1", newNegState(3, 2, 0))
+	if diff := cmp.Diff(expectChanges, newMetrics.negCountChanges); diff != "" {
+		t.Errorf("Got diff for neg count changes after identical update (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeStandaloneNegFraction(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	if gotFraction := newMetrics.computeStandaloneNegFraction(); gotFraction != 0 {
+		t.Errorf("computeStandaloneNegFraction() = %v without tracked NEGs, want 0", gotFraction)
+	}
+	// 6 standalone NEGs out of 8 NEGs in total.
+	newMetrics.SetNegService("default/standalone-service", newNegState(5, 0, 0))
+	newMetrics.SetNegService("default/mixed-service", newNegState(1, 1, 1))
+	if gotFraction := newMetrics.computeStandaloneNegFraction(); gotFraction != 0.75 {
+		t.Errorf("computeStandaloneNegFraction() = %v, want 0.75", gotFraction)
+	}
+}
+
+func TestComputeIngressNegRatio(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	if gotRatio := newMetrics.computeIngressNegRatio(); gotRatio != 0 {
+		t.Errorf("computeIngressNegRatio() = %v without tracked ingresses, want 0", gotRatio)
+	}
+	// 6 ingress NEGs across 2 ingresses; standalone and ASM NEGs do not
+	// contribute.
+	newMetrics.SetIngress("default/ingress0", NewIngressState(ingressStates[0].ing, nil))
+	newMetrics.SetIngress("default/ingress1", NewIngressState(ingressStates[1].ing, nil))
+	newMetrics.SetNegService("default/neg-service1", newNegState(1, 2, 1))
+	newMetrics.SetNegService("default/neg-service2", newNegState(0, 4, 0))
+	if gotRatio := newMetrics.computeIngressNegRatio(); gotRatio != 3 {
+		t.Errorf("computeIngressNegRatio() = %v, want 3", gotRatio)
+	}
+}
+
+func TestComputeAsmAndIngressNegServices(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	newMetrics.SetNegService("default/asm-and-ingress-service", newNegState(0, 1, 2))
+	newMetrics.SetNegService("default/asm-only-service", newNegState(0, 0, 1))
+	newMetrics.SetNegService("default/ingress-only-service", newNegState(1, 2, 0))
+
+	if gotCount := newMetrics.computeAsmAndIngressNegServices(); gotCount != 1 {
+		t.Errorf("Got %d services with both ASM and ingress NEGs, want 1", gotCount)
+	}
+}
+
+func TestComputeNegReadinessGateServices(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	readinessGateState := newNegState(1, 1, 0)
+	readinessGateState.ReadinessGateEnabled = true
+	newMetrics.SetNegService("default/readiness-gate-service", readinessGateState)
+	newMetrics.SetNegService("default/plain-service", newNegState(0, 1, 0))
+
+	if gotCount := newMetrics.computeNegReadinessGateServices(); gotCount != 1 {
+		t.Errorf("Got %d readiness gate services, want 1", gotCount)
+	}
+	if gotCount := newMetrics.computeNegMetrics()[negReadinessGate]; gotCount != 1 {
+		t.Errorf("Got %d services counted for feature %s, want 1", gotCount, negReadinessGate)
+	}
+}
+
+func TestAsmNegSubsetting(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	subsettingState := newNegState(0, 0, 2)
+	subsettingState.SubsettingEnabled = true
+	newMetrics.SetNegService("default/subsetting-service", subsettingState)
+	newMetrics.SetNegService("default/plain-asm-service", newNegState(0, 0, 1))
+
+	if gotCount := newMetrics.computeNegMetrics()[asmNegSubsetting]; gotCount != 1 {
+		t.Errorf("Got %d services counted for feature %s, want 1", gotCount, asmNegSubsetting)
+	}
+}
+
+func TestComputeNegEndpointHistogram(t *testing.T) {
+	t.Parallel()
+	newMetrics := NewControllerMetrics()
+	for i, endpointCount := range []int{0, 3, 10, 42, 250} {
+		negState := newNegState(0, 1, 0)
+		negState.EndpointCount = endpointCount
+		newMetrics.SetNegService(fmt.Sprintf("default/neg-service%d", i), negState)
+	}
+
+	expectHistogram := map[string]int{
+		"0":      1,
+		"1-10":   2,
+		"11-100": 1,
+		"100+":   1,
+	}
+	if diff := cmp.Diff(expectHistogram, newMetrics.computeNegEndpointHistogram()); diff != "" {
+		t.Errorf("Got diff for NEG endpoint histogram (-want +got):\n%s", diff)
+	}
+}
+
 func newNegState(standalone, ingress, asm int) NegServiceState {
 	return NegServiceState{
 		IngressNeg:    ingress,
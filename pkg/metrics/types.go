@@ -17,14 +17,45 @@ limitations under the License.
 package metrics
 
 import (
+	"time"
+
 	"k8s.io/api/networking/v1beta1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
 // IngressState defines an ingress and its associated service ports.
 type IngressState struct {
-	ingress      *v1beta1.Ingress
-	servicePorts []utils.ServicePort
+	ingress        *v1beta1.Ingress
+	frontendconfig *frontendconfigv1beta1.FrontendConfig
+	servicePorts   []utils.ServicePort
+	// certExpiries holds the expiry times of the secret-based certs
+	// referenced by the ingress, as observed by the cert collector.
+	certExpiries []time.Time
+	// apiVersion is the networking API version the ingress was read from,
+	// "v1" or "v1beta1". Untagged states default to "v1beta1".
+	apiVersion string
+	// sslPolicyMinTLSVersion is the minimum TLS version of the SSL policy
+	// referenced by the frontend config, e.g. "TLS_1_2", as observed on the
+	// GCE resource.
+	sslPolicyMinTLSVersion string
+}
+
+// SetSSLPolicyMinTLSVersion records the minimum TLS version of the SSL policy
+// referenced by this ingress state.
+func (s *IngressState) SetSSLPolicyMinTLSVersion(version string) {
+	s.sslPolicyMinTLSVersion = version
+}
+
+// SetAPIVersion records the networking API version the ingress was read from.
+func (s *IngressState) SetAPIVersion(version string) {
+	s.apiVersion = version
+}
+
+// SetCertExpiries records the expiry times of the secret-based certs
+// referenced by this ingress state.
+func (s *IngressState) SetCertExpiries(expiries []time.Time) {
+	s.certExpiries = expiries
 }
 
 // NegServiceState contains all the neg usage associated with one service
@@ -35,6 +66,15 @@ type NegServiceState struct {
 	IngressNeg int
 	// asmNeg is the count of NEGs created for ASM
 	AsmNeg int
+	// subsettingEnabled indicates that the ASM NEGs of this service use
+	// custom endpoint subsetting.
+	SubsettingEnabled bool
+	// readinessGateEnabled indicates that the pods backing the NEGs of this
+	// service use the NEG readiness gate.
+	ReadinessGateEnabled bool
+	// endpointCount is the number of endpoints backing the NEGs of this
+	// service.
+	EndpointCount int
 }
 
 // IngressMetricsCollector is an interface to update/delete ingress states in the cache